@@ -0,0 +1,130 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrReleased is returned by a result after the reply arena backing the result value was released.
+var ErrReleased = errors.New("result value released")
+
+const (
+	minArenaValues = 64
+	minArenaItems  = 32
+)
+
+// A replyArena provides the memory of the aggregate values (arrays, sets, maps and attributes)
+// of a reply. String values are not backed by the arena and stay valid after the arena is released.
+type replyArena struct {
+	values []RedisValue
+	items  []MapItem
+}
+
+var arenaPool = sync.Pool{
+	New: func() interface{} {
+		return &replyArena{
+			values: make([]RedisValue, 0, minArenaValues),
+			items:  make([]MapItem, 0, minArenaItems),
+		}
+	},
+}
+
+func getArena() *replyArena { return arenaPool.Get().(*replyArena) }
+
+// release clears the arena and puts it back to the pool.
+// Only the used part of the current blocks needs to be cleared, as the remaining
+// capacity was never used or cleared by a previous release.
+func (a *replyArena) release() {
+	for i := range a.values {
+		a.values[i] = nil
+	}
+	for i := range a.items {
+		a.items[i] = MapItem{}
+	}
+	a.values, a.items = a.values[:0], a.items[:0]
+	arenaPool.Put(a)
+}
+
+// slice returns an empty slice with capacity n.
+// In case the arena capacity is exceeded a new block is allocated - previous blocks stay
+// referenced by the values already allocated and are garbage collected after release.
+func (a *replyArena) slice(n int) []RedisValue {
+	l := len(a.values)
+	if cap(a.values)-l < n {
+		size := 2 * cap(a.values)
+		if size < n {
+			size = n
+		}
+		a.values, l = make([]RedisValue, 0, size), 0
+	}
+	a.values = a.values[:l+n]
+	return a.values[l : l : l+n]
+}
+
+// mapItems returns an empty map item slice with capacity n.
+func (a *replyArena) mapItems(n int) []MapItem {
+	l := len(a.items)
+	if cap(a.items)-l < n {
+		size := 2 * cap(a.items)
+		if size < n {
+			size = n
+		}
+		a.items, l = make([]MapItem, 0, size), 0
+	}
+	a.items = a.items[:l+n]
+	return a.items[l : l : l+n]
+}
+
+// An arenaReply is a reply decoded into a reply arena.
+type arenaReply struct {
+	value RedisValue
+	arena *replyArena
+}
+
+// cloneValue returns a copy of v not backed by a reply arena.
+func cloneValue(v RedisValue) RedisValue {
+	switch v := v.(type) {
+	case _slice:
+		return _slice(cloneValues(v))
+	case _set:
+		return _set(cloneValues(v))
+	case _map:
+		return cloneMap(v)
+	case attrRedisValue:
+		return attrRedisValue{RedisValue: cloneValue(v.RedisValue), attr: cloneMap(v.attr)}
+	default:
+		return v
+	}
+}
+
+func cloneValues(values []RedisValue) []RedisValue {
+	c := make([]RedisValue, len(values))
+	for i, v := range values {
+		c[i] = cloneValue(v)
+	}
+	return c
+}
+
+func cloneMap(m _map) _map {
+	c := make(_map, len(m))
+	for i, item := range m {
+		c[i] = MapItem{Key: cloneValue(item.Key), Value: cloneValue(item.Value)}
+	}
+	return c
+}
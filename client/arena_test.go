@@ -0,0 +1,124 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeArena(t *testing.T) {
+	const data = "+OK\r\n" +
+		"*2\r\n$1\r\na\r\n%1\r\n$1\r\nk\r\n*3\r\n:1\r\n:2\r\n~1\r\n$1\r\nv\r\n" +
+		"|1\r\n+key\r\n+value\r\n*1\r\n*1\r\n:3\r\n"
+
+	expected := []RedisValue{
+		_string("OK"),
+		_slice{_string("a"), _map{{_string("k"), _slice{_number(1), _number(2), _set{_string("v")}}}}},
+		attrRedisValue{RedisValue: _slice{_slice{_number(3)}}, attr: _map{{_string("key"), _string("value")}}},
+	}
+
+	dec := newDecode(strings.NewReader(data), true)
+	var arenas []*replyArena
+	for i, e := range expected {
+		v, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 { // no aggregate - no arena
+			if !reflect.DeepEqual(v, e) {
+				t.Fatalf("got: %v expected: %v", v, e)
+			}
+			continue
+		}
+		reply, ok := v.(*arenaReply)
+		if !ok {
+			t.Fatalf("got: %T expected: %T", v, reply)
+		}
+		if !reflect.DeepEqual(reply.value, e) {
+			t.Fatalf("got: %v expected: %v", reply.value, e)
+		}
+		c := cloneValue(reply.value)
+		arenas = append(arenas, reply.arena)
+		reply.arena.release()
+		if !reflect.DeepEqual(c, e) { // clone is not affected by release
+			t.Fatalf("got: %v expected: %v", c, e)
+		}
+	}
+	if arenas[0] == nil || arenas[1] == nil {
+		t.Fatal("arena missing")
+	}
+}
+
+func TestReplyArena(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	conn, err := (&Dialer{ReplyArena: true}).Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.HsetStruct("hash", hashAddress{City: "Berlin", Zip: "10115"}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"City": "Berlin", "Zip": "10115"}
+
+	// released by conversion
+	r := conn.Hgetall("hash")
+	m, err := r.ToStringStringMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("got: %v expected: %v", m, expected)
+	}
+	if err := r.Err(); err != ErrReleased {
+		t.Fatalf("got: %v expected: %v", err, ErrReleased)
+	}
+
+	// explicit release
+	r = conn.Hmget("hash", []interface{}{"City", "Zip"})
+	v, err := r.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, _slice{_string("Berlin"), _string("10115")}) {
+		t.Fatalf("unexpected value %v", v)
+	}
+	r.Release()
+	if _, err := r.Value(); err != ErrReleased {
+		t.Fatalf("got: %v expected: %v", err, ErrReleased)
+	}
+
+	// results decoded by the client are not backed by an arena
+	var a hashAddress
+	if err := conn.HgetallInto("hash", &a).Err(); err != nil {
+		t.Fatal(err)
+	}
+	r = conn.Get("unknown") // no aggregate
+	r.Release()
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if a.City != "Berlin" || a.Zip != "10115" {
+		t.Fatalf("unexpected value %v", a)
+	}
+}
@@ -134,3 +134,42 @@ func BenchmarkCommand(b *testing.B) {
 		b.Fatal(err)
 	}
 }
+
+func benchmarkHgetall(conn client.Conn, b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m, err := conn.Hgetall("hash").ToStringStringMap()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(m) != 100 {
+			b.Fatal("got wrong number of fields")
+		}
+	}
+}
+
+func BenchmarkReplyArena(b *testing.B) {
+	for _, arena := range []bool{false, true} {
+		name := "HgetallDefault"
+		if arena {
+			name = "HgetallArena"
+		}
+		dialer := client.Dialer{ReplyArena: arena}
+		conn, err := dialer.Dial("")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := conn.Del([]interface{}{"hash"}).Err(); err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			if err := conn.Hset("hash", []client.FieldValue{{Field: strconv.Itoa(i), Value: i}}).Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.Run(name, func(b *testing.B) { benchmarkHgetall(conn, b) })
+		if err := conn.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"io"
+)
+
+// A BulkReader is a command argument sending Size bytes read from R as bulk string
+// without materializing the whole value in memory, e.g.
+//
+//	conn.Set("key", client.BulkReader{R: file, Size: fileSize})
+//
+// In case R provides less than Size bytes, the command fails and the connection
+// cannot be used anymore.
+// As R is consumed by sending the command, a BulkReader cannot be sent more than once
+// (e.g. it should not be used for commands redirected by a Redis cluster).
+type BulkReader struct {
+	R    io.Reader
+	Size int64
+}
+
+// BulkCommands are the commands streaming large bulk string replies and values.
+//
+// The reply of GetTo and DumpTo is written to w by the connection reader while the
+// reply is received, so w should not block. The result value is the number of bytes
+// written to w or null if the key does not exist. In case w returns an error, the
+// reply is discarded and the result error is set to the write error.
+//
+// Replies decoded by a tracing connection (please see Dialer.TraceCallback) or
+// replies including attributes are materialized before they are written to w.
+type BulkCommands interface {
+	// GetTo writes the string value of key to w (GET).
+	GetTo(key interface{}, w io.Writer) Result
+	// DumpTo writes the serialized value of key to w (DUMP).
+	DumpTo(key interface{}, w io.Writer) Result
+	// RestoreFrom creates key from the serialized value read from r (RESTORE).
+	RestoreFrom(key interface{}, ttl int64, r io.Reader, size int64, replace bool) Result
+}
+
+// GetTo writes the string value of key to w (GET).
+func (c *command) GetTo(key interface{}, w io.Writer) Result {
+	r := newResult()
+	if w == nil {
+		r.setErr(newInvalidValueError("w", w))
+		return r
+	}
+	r.request.cmd = append(r.request.cmd, "GET", key)
+	r.request.w = w
+	c.send(CmdGet, r)
+	return r
+}
+
+// DumpTo writes the serialized value of key to w (DUMP).
+func (c *command) DumpTo(key interface{}, w io.Writer) Result {
+	r := newResult()
+	if w == nil {
+		r.setErr(newInvalidValueError("w", w))
+		return r
+	}
+	r.request.cmd = append(r.request.cmd, "DUMP", key)
+	r.request.w = w
+	c.send(CmdDump, r)
+	return r
+}
+
+// RestoreFrom creates key from the serialized value read from r (RESTORE).
+func (c *command) RestoreFrom(key interface{}, ttl int64, rd io.Reader, size int64, replace bool) Result {
+	r := newResult()
+	r.request.cmd = append(r.request.cmd, "RESTORE", key, ttl, BulkReader{R: rd, Size: size})
+	if replace {
+		r.request.cmd = append(r.request.cmd, "REPLACE")
+	}
+	c.send(CmdRestore, r)
+	return r
+}
+
+// writeValue writes a materialized bulk string reply to w returning the number of bytes written.
+func writeValue(w io.Writer, v RedisValue) (RedisValue, error) {
+	if a, ok := v.(attrRedisValue); ok {
+		v = a.RedisValue
+	}
+	s, ok := v.(_string)
+	if !ok { // null, ...
+		return v, nil
+	}
+	n, err := io.WriteString(w, string(s))
+	if err != nil {
+		return nil, err
+	}
+	return _number(n), nil
+}
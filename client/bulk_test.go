@@ -0,0 +1,125 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+type failingWriter struct{ n int }
+
+var errWrite = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return 0, errWrite
+}
+
+func TestBulk(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	s.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		switch strings.ToUpper(cmd[0]) {
+		case "DUMP":
+			bulk(w, "\x00\x05hello")
+		case "RESTORE":
+			w.WriteString("+OK\r\n")
+		case "GET":
+			if cmd[1] != "streamed" {
+				return false
+			}
+			w.WriteString("$?\r\n;4\r\nHell\r\n;1\r\no\r\n;0\r\n")
+		default:
+			return false
+		}
+		return true
+	}
+
+	conn, err := Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	value := strings.Repeat("0123456789", 10000) // exceeds reader chunk size
+	if err := conn.Set("key", BulkReader{R: strings.NewReader(value), Size: int64(len(value))}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var b1, b2, b3 bytes.Buffer
+	fw := &failingWriter{}
+
+	p := conn.Pipeline()
+	r1 := p.GetTo("key", &b1)
+	r2 := p.Get("key")
+	r3 := p.GetTo("streamed", &b2)
+	r4 := p.GetTo("unknown", &b3)
+	r5 := p.GetTo("key", fw)
+	r6 := p.DumpTo("key", &b3)
+	r7 := p.Get("key") // reply in sync after write error
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	testWritten := func(r Result, b *bytes.Buffer, expected string) {
+		t.Helper()
+		n, err := r.ToInt64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(expected)) || b.String() != expected {
+			t.Fatalf("got: %d bytes expected: %d bytes", n, len(expected))
+		}
+	}
+
+	testWritten(r1, &b1, value)
+	if s, err := r2.ToString(); err != nil || s != value {
+		t.Fatalf("unexpected result %v", err)
+	}
+	testWritten(r3, &b2, "Hello")
+	if null, err := r4.IsNull(); err != nil || !null {
+		t.Fatalf("got: %v expected: null", err)
+	}
+	if err := r5.Err(); err != errWrite || fw.n == 0 {
+		t.Fatalf("got: %v expected: %v", err, errWrite)
+	}
+	testWritten(r6, &b3, "\x00\x05hello")
+	if s, err := r7.ToString(); err != nil || s != value {
+		t.Fatalf("unexpected result %v", err)
+	}
+
+	if err := conn.RestoreFrom("key2", 0, &b3, int64(b3.Len()), true).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.countCmds("RESTORE KEY2 0 \x00\x05HELLO REPLACE"); n != 1 {
+		t.Fatal("RESTORE not sent")
+	}
+}
+
+func TestBulkReaderShort(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer))
+	if err := enc.Encode([]interface{}{"SET", "key", &BulkReader{R: strings.NewReader("abc"), Size: 4}}); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got: %v expected: %v", err, io.ErrUnexpectedEOF)
+	}
+}
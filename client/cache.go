@@ -0,0 +1,504 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCacheMaxEntries is the default maximum number of cache entries.
+const DefaultCacheMaxEntries = 10000
+
+// TrackingMode is the Redis client side caching tracking mode.
+type TrackingMode int
+
+// Tracking modes (please see Redis CLIENT TRACKING).
+const (
+	// TrackingDefault: Redis tracks the keys read by the connection.
+	TrackingDefault TrackingMode = iota
+	// TrackingBcast: Redis broadcasts invalidations for all keys matching the prefixes.
+	TrackingBcast
+	// TrackingOptin: Redis tracks the keys of commands preceded by CLIENT CACHING yes.
+	// The cache sends CLIENT CACHING yes for all cacheable commands.
+	TrackingOptin
+)
+
+// cacheableCommands are the read commands served by the cache.
+// The value is true if all command arguments are keys, false if the first argument is the only key.
+var cacheableCommands = map[string]bool{
+	CmdBitcount: false, CmdBitpos: false, CmdGet: false, CmdGetbit: false, CmdGetrange: false, CmdStrlen: false, CmdMget: true,
+	CmdExists: true, CmdType: false,
+	CmdGeodist: false, CmdGeohash: false, CmdGeopos: false,
+	CmdHexists: false, CmdHget: false, CmdHgetall: false, CmdHkeys: false, CmdHlen: false, CmdHmget: false, CmdHstrlen: false, CmdHvals: false,
+	CmdLindex: false, CmdLlen: false, CmdLpos: false, CmdLrange: false,
+	CmdScard: false, CmdSismember: false, CmdSmembers: false, CmdSdiff: true, CmdSinter: true, CmdSunion: true,
+	CmdZcard: false, CmdZcount: false, CmdZlexcount: false, CmdZrange: false, CmdZrangebylex: false, CmdZrangebyscore: false,
+	CmdZrank: false, CmdZrevrange: false, CmdZrevrangebylex: false, CmdZrevrangebyscore: false, CmdZrevrank: false, CmdZscore: false,
+	CmdXlen: false, CmdXrange: false, CmdXrevrange: false,
+}
+
+// CacheOptions are the client side cache options.
+type CacheOptions struct {
+	// Tracking mode.
+	Mode TrackingMode
+	// Key prefixes (TrackingBcast only). Only keys matching one of the prefixes are cached.
+	Prefixes []string
+	// Redirect invalidation messages to a dedicated connection (please see CLIENT TRACKING REDIRECT).
+	Redirect bool
+	// Maximum number of cache entries. Zero means DefaultCacheMaxEntries, a negative value means unlimited.
+	MaxEntries int
+	// Maximum size of the cached values in bytes (approximation). Zero means unlimited.
+	MaxSize int64
+	// Time to live of cache entries. Zero means entries are valid until invalidated or evicted.
+	TTL time.Duration
+}
+
+// CacheStats are the client side cache statistics.
+type CacheStats struct {
+	Entries       int   // Number of cache entries.
+	Size          int64 // Size of the cached values in bytes (approximation).
+	Hits          int64 // Total number of commands served by the cache.
+	Misses        int64 // Total number of cacheable commands sent to Redis.
+	Evictions     int64 // Total number of entries removed because of size limits or ttl.
+	Invalidations int64 // Total number of entries removed because of Redis invalidation messages.
+	Flushes       int64 // Total number of complete cache invalidations.
+}
+
+// Cache is a client side cache based on Redis server assisted client side caching (please see CLIENT TRACKING).
+// Cacheable read commands are served by the cache if possible, all other commands are sent to Redis.
+// All entries are invalidated if tracking information might have got lost (connection lost or closed).
+// Values returned by the cache are shared and must not be modified.
+type Cache struct {
+	enabled int32 // atomic access - zero if the invalidation connection got lost
+
+	opts CacheOptions
+
+	conn     *conn  // cache connection - nil if cache is using a db
+	db       *db    // cache db - nil if cache is using a connection
+	inv      *conn  // invalidation connection - nil if Redirect option is not set
+	redirect *int64 // client id of the invalidation connection - nil if Redirect option is not set
+
+	mu       sync.Mutex
+	lru      *list.List
+	entries  map[string]*list.Element
+	index    map[string]map[*list.Element]struct{} // redis key -> cache entries
+	inflight map[string]*cacheInflight             // redis key -> commands in flight
+	stats    CacheStats
+
+	*command
+}
+
+type cacheEntry struct {
+	id      string // command and arguments
+	keys    []string
+	value   RedisValue
+	size    int64
+	expires time.Time // zero if ttl is not set
+}
+
+// cacheInflight records if a key got invalidated while commands reading the key are in flight.
+type cacheInflight struct {
+	n           int
+	invalidated bool
+}
+
+// DialCache connects to the Redis server at address and returns a cache using a single connection.
+func DialCache(ctx context.Context, address string, dialer Dialer, opts CacheOptions) (*Cache, error) {
+	c, err := newCache(ctx, address, &dialer, opts)
+	if err != nil {
+		return nil, err
+	}
+	if c.conn, err = dialer.dialContext(ctx, address); err != nil {
+		c.closeInv()
+		return nil, err
+	}
+	if err := c.track(c.conn); err != nil {
+		c.conn.Close()
+		c.closeInv()
+		return nil, err
+	}
+	return c, nil
+}
+
+// OpenCache returns a cache using a connection pool (please see OpenDB).
+// Tracking is enabled on all pool connections.
+func OpenCache(ctx context.Context, address string, dialer Dialer, opts CacheOptions) (*Cache, error) {
+	c, err := newCache(ctx, address, &dialer, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.db = newDB(address, dialer)
+	c.db.onConnect = c.track
+	return c, nil
+}
+
+// newCache creates the cache, dials the invalidation connection if needed and
+// sets the invalidation callback of dialer.
+func newCache(ctx context.Context, address string, dialer *Dialer, opts CacheOptions) (*Cache, error) {
+	if opts.MaxEntries == 0 {
+		opts.MaxEntries = DefaultCacheMaxEntries
+	}
+	c := &Cache{
+		enabled:  1,
+		opts:     opts,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		index:    make(map[string]map[*list.Element]struct{}),
+		inflight: make(map[string]*cacheInflight),
+	}
+	c.command = newCommand(c.send, nil)
+
+	invalidateCallback := dialer.InvalidateCallback
+	dialer.InvalidateCallback = func(keys []string) {
+		c.invalidate(keys)
+		if invalidateCallback != nil {
+			invalidateCallback(keys)
+		}
+	}
+
+	if opts.Redirect {
+		invDialer := *dialer
+		invDialer.Reconnect = false // a new client id would break the redirection
+		var err error
+		if c.inv, err = invDialer.dialContext(ctx, address); err != nil {
+			return nil, err
+		}
+		id, err := c.inv.ClientId().ToInt64()
+		if err != nil {
+			c.inv.Close()
+			return nil, err
+		}
+		c.redirect = &id
+		go func(shutdown <-chan bool) {
+			<-shutdown
+			atomic.StoreInt32(&c.enabled, 0) // tracking lost - stop caching
+			c.invalidate(nil)
+		}(c.inv.shutdown)
+	}
+	return c, nil
+}
+
+// track enables tracking on connection conn.
+func (c *Cache) track(conn *conn) error {
+	var prefixes []string
+	if c.opts.Mode == TrackingBcast {
+		prefixes = c.opts.Prefixes
+	}
+	return conn.ClientTracking(true, c.redirect, prefixes, c.opts.Mode == TrackingBcast, c.opts.Mode == TrackingOptin, false, false).Err()
+}
+
+func (c *Cache) closeInv() {
+	if c.inv != nil {
+		c.inv.Close()
+	}
+}
+
+// WithContext returns the cache commands bound to ctx.
+func (c *Cache) WithContext(ctx context.Context) Commands {
+	return newCommand(contextSend(ctx, c.send), nil)
+}
+
+// Close closes the cache connection(s) and invalidates all entries.
+func (c *Cache) Close() error {
+	var err error
+	if c.conn != nil {
+		err = c.conn.Close()
+	} else {
+		err = c.db.close()
+	}
+	c.closeInv()
+	c.invalidate(nil)
+	return err
+}
+
+// Flush invalidates all cache entries.
+func (c *Cache) Flush() { c.invalidate(nil) }
+
+// Stats returns the cache statistics.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+func (c *Cache) send(name string, r *result) {
+	keys, ok := c.cacheKeys(name, r.cmd())
+	if !ok || atomic.LoadInt32(&c.enabled) == 0 || r.request.w != nil { // replies written to w are not cached
+		c.sendBackend(name, r, false)
+		return
+	}
+
+	id := cacheID(r.cmd())
+	if value, ok := c.get(id); ok {
+		r.flush()
+		r.ack(value, nil)
+		return
+	}
+
+	c.beginInflight(keys)
+	var once int32
+	complete := func(value RedisValue, err error) {
+		if atomic.CompareAndSwapInt32(&once, 0, 1) {
+			c.endInflight(id, keys, value, err)
+		}
+	}
+	onAck := r.request.onAck
+	r.request.onAck = func(value RedisValue, err error) error {
+		complete(value, err)
+		if onAck != nil {
+			return onAck(value, err)
+		}
+		return err
+	}
+	c.sendBackend(name, r, c.opts.Mode == TrackingOptin)
+	if atomic.LoadUint32(&r.flags) == rsAvailable { // not sent - error set (no-op if already acknowledged)
+		complete(nil, r.err)
+	}
+}
+
+// sendBackend sends the command to Redis. In case of optin the command is preceded by CLIENT CACHING yes.
+func (c *Cache) sendBackend(name string, r *result, optin bool) {
+	if !optin {
+		if c.conn != nil {
+			c.conn.send(name, r)
+		} else {
+			c.db.send(name, r)
+		}
+		return
+	}
+
+	sendOptin := func(conn *conn) {
+		caching := newResult()
+		caching.request.cmd = append(caching.request.cmd, "CLIENT", "CACHING", "YES")
+		results := freeResults.get()
+		results = append(results, caching, r)
+		conn.flush(true, results)
+	}
+	if c.conn != nil {
+		sendOptin(c.conn)
+	} else {
+		c.db.withConn(r, sendOptin)
+	}
+}
+
+// cacheKeys returns the keys of a cacheable command.
+func (c *Cache) cacheKeys(name string, cmd []interface{}) ([]string, bool) {
+	allKeys, ok := cacheableCommands[name]
+	if !ok || len(cmd) < 2 {
+		return nil, false
+	}
+	n := 1
+	if allKeys {
+		n = len(cmd) - 1
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		key, ok := tokenString(cmd[i+1])
+		if !ok || !c.tracked(key) {
+			return nil, false
+		}
+		keys[i] = key
+	}
+	return keys, true
+}
+
+// tracked returns true if the key is tracked by Redis.
+func (c *Cache) tracked(key string) bool {
+	if c.opts.Mode != TrackingBcast || len(c.opts.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.opts.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheID returns the cache entry identifier of a command.
+func cacheID(cmd []interface{}) string {
+	var b strings.Builder
+	for _, arg := range cmd {
+		s, _ := tokenString(arg)
+		b.WriteString(s)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func (c *Cache) get(id string) (RedisValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.removeLocked(e)
+		c.stats.Evictions++
+		c.stats.Misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	c.stats.Hits++
+	return entry.value, true
+}
+
+func (c *Cache) beginInflight(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		f, ok := c.inflight[key]
+		if !ok {
+			f = &cacheInflight{}
+			c.inflight[key] = f
+		}
+		f.n++
+	}
+}
+
+// endInflight stores the command result if no key got invalidated in the meanwhile.
+func (c *Cache) endInflight(id string, keys []string, value RedisValue, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	store := err == nil && atomic.LoadInt32(&c.enabled) != 0
+	for _, key := range keys {
+		f := c.inflight[key]
+		if f.invalidated {
+			store = false
+		}
+		if f.n--; f.n == 0 {
+			delete(c.inflight, key)
+		}
+	}
+	if store {
+		c.addLocked(id, keys, value)
+	}
+}
+
+func (c *Cache) addLocked(id string, keys []string, value RedisValue) {
+	if e, ok := c.entries[id]; ok {
+		c.removeLocked(e)
+	}
+	entry := &cacheEntry{id: id, keys: keys, value: value, size: valueSize(value)}
+	if c.opts.TTL > 0 {
+		entry.expires = time.Now().Add(c.opts.TTL)
+	}
+	e := c.lru.PushFront(entry)
+	c.entries[id] = e
+	for _, key := range keys {
+		m, ok := c.index[key]
+		if !ok {
+			m = make(map[*list.Element]struct{})
+			c.index[key] = m
+		}
+		m[e] = struct{}{}
+	}
+	c.stats.Size += entry.size
+
+	for (c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries) || (c.opts.MaxSize > 0 && c.stats.Size > c.opts.MaxSize) {
+		c.removeLocked(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) removeLocked(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, entry.id)
+	for _, key := range entry.keys {
+		if m, ok := c.index[key]; ok {
+			delete(m, e)
+			if len(m) == 0 {
+				delete(c.index, key)
+			}
+		}
+	}
+	c.stats.Size -= entry.size
+}
+
+// invalidate removes the cache entries of keys - all entries if keys is nil.
+func (c *Cache) invalidate(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if keys == nil {
+		c.lru.Init()
+		c.entries = make(map[string]*list.Element)
+		c.index = make(map[string]map[*list.Element]struct{})
+		c.stats.Size = 0
+		c.stats.Flushes++
+		for _, f := range c.inflight {
+			f.invalidated = true
+		}
+		return
+	}
+
+	for _, key := range keys {
+		if f, ok := c.inflight[key]; ok {
+			f.invalidated = true
+		}
+		for e := range c.index[key] {
+			c.removeLocked(e)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+// valueSize returns the approximate size of a redis value in bytes.
+func valueSize(v RedisValue) int64 {
+	const minSize = 8
+
+	switch v := v.(type) {
+	case _string:
+		return int64(len(v)) + minSize
+	case _verbatimString:
+		return int64(len(v)) + minSize
+	case _slice:
+		return sliceSize(v)
+	case _set:
+		return sliceSize(v)
+	case _map:
+		size := int64(minSize)
+		for _, item := range v {
+			size += valueSize(item.Key) + valueSize(item.Value)
+		}
+		return size
+	case attrRedisValue:
+		return valueSize(v.RedisValue) + valueSize(v.attr)
+	default:
+		return minSize
+	}
+}
+
+func sliceSize(v []RedisValue) int64 {
+	size := int64(8)
+	for _, item := range v {
+		size += valueSize(item)
+	}
+	return size
+}
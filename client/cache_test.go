@@ -0,0 +1,202 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCacheFakeServer(t *testing.T) *fakeServer {
+	s := newFakeServer(t)
+	s.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		if len(cmd) == 2 && strings.EqualFold(cmd[0], "client") && strings.EqualFold(cmd[1], "id") {
+			w.WriteString(":42\r\n")
+			return true
+		}
+		return false
+	}
+	return s
+}
+
+func (s *fakeServer) countCmds(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, cmd := range s.cmds {
+		if strings.HasPrefix(strings.ToUpper(cmd), prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func waitCacheStats(t *testing.T, c *Cache, cond func(stats CacheStats) bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond(c.Stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected cache stats %v", c.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testCacheGet(t *testing.T, c *Cache, key, expected string) {
+	v, err := c.Get(key).ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != expected {
+		t.Fatalf("got: %s expected: %s", v, expected)
+	}
+}
+
+func TestCache(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		opts     CacheOptions
+		tracking string
+		open     bool
+	}{
+		{"default", CacheOptions{}, "CLIENT TRACKING ON", false},
+		{"bcast", CacheOptions{Mode: TrackingBcast, Prefixes: []string{"key"}}, "CLIENT TRACKING ON PREFIX KEY BCAST", false},
+		{"optin", CacheOptions{Mode: TrackingOptin}, "CLIENT TRACKING ON OPTIN", false},
+		{"redirect", CacheOptions{Redirect: true}, "CLIENT TRACKING ON REDIRECT 42", false},
+		{"db", CacheOptions{}, "CLIENT TRACKING ON", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := newCacheFakeServer(t)
+			defer s.ln.Close()
+			s.kv["key"] = "value1"
+
+			var c *Cache
+			var err error
+			if test.open {
+				c, err = OpenCache(context.Background(), s.addr(), Dialer{}, test.opts)
+			} else {
+				c, err = DialCache(context.Background(), s.addr(), Dialer{}, test.opts)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			testCacheGet(t, c, "key", "value1")
+			testCacheGet(t, c, "key", "value1")
+
+			if n := s.countCmds("GET"); n != 1 {
+				t.Fatalf("got: %d expected: %d GET commands", n, 1)
+			}
+			if n := s.countCmds(test.tracking); n != 1 {
+				t.Fatalf("tracking command %q not sent", test.tracking)
+			}
+			if test.opts.Mode == TrackingOptin && s.countCmds("CLIENT CACHING YES") != 1 {
+				t.Fatal("client caching command not sent")
+			}
+			if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+				t.Fatalf("unexpected cache stats %v", stats)
+			}
+
+			// keys not matching the prefixes are not cached in bcast mode
+			if test.opts.Mode == TrackingBcast {
+				s.mu.Lock()
+				s.kv["other"] = "value"
+				s.mu.Unlock()
+				testCacheGet(t, c, "other", "value")
+				testCacheGet(t, c, "other", "value")
+				if n := s.countCmds("GET OTHER"); n != 2 {
+					t.Fatalf("got: %d expected: %d GET commands", n, 2)
+				}
+			}
+
+			s.mu.Lock()
+			s.kv["key"] = "value2"
+			s.mu.Unlock()
+			s.invalidate([]string{"key"})
+			waitCacheStats(t, c, func(stats CacheStats) bool { return stats.Invalidations == 1 })
+
+			testCacheGet(t, c, "key", "value2")
+			if n := s.countCmds("GET KEY"); n != 2 {
+				t.Fatalf("got: %d expected: %d GET commands", n, 2)
+			}
+
+			// flush (redirect: all connections are receiving the invalidation message)
+			s.invalidate(nil)
+			waitCacheStats(t, c, func(stats CacheStats) bool { return stats.Entries == 0 && stats.Flushes > 0 })
+		})
+	}
+}
+
+func TestCacheLimits(t *testing.T) {
+	s := newCacheFakeServer(t)
+	defer s.ln.Close()
+	for _, key := range []string{"key1", "key2", "key3"} {
+		s.kv[key] = key
+	}
+
+	c, err := DialCache(context.Background(), s.addr(), Dialer{}, CacheOptions{MaxEntries: 2, TTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		testCacheGet(t, c, key, key)
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Fatalf("unexpected cache stats %v", stats)
+	}
+	testCacheGet(t, c, "key1", "key1") // evicted (lru)
+	if n := s.countCmds("GET KEY1"); n != 2 {
+		t.Fatalf("got: %d expected: %d GET commands", n, 2)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	testCacheGet(t, c, "key3", "key3") // expired
+	if n := s.countCmds("GET KEY3"); n != 2 {
+		t.Fatalf("got: %d expected: %d GET commands", n, 2)
+	}
+}
+
+func TestCacheConnLost(t *testing.T) {
+	s := newCacheFakeServer(t)
+	defer s.ln.Close()
+	s.kv["key"] = "value"
+
+	c, err := DialCache(context.Background(), s.addr(), Dialer{Reconnect: true, ReconnectBackoff: func(int) time.Duration { return 10 * time.Millisecond }}, CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	testCacheGet(t, c, "key", "value")
+	s.dropAll()
+	waitCacheStats(t, c, func(stats CacheStats) bool { return stats.Entries == 0 && stats.Flushes == 1 })
+
+	deadline := time.Now().Add(time.Second)
+	for s.countCmds("CLIENT TRACKING ON") != 2 { // wait for tracking to be restored
+		if time.Now().After(deadline) {
+			t.Fatal("tracking not restored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	testCacheGet(t, c, "key", "value")
+}
@@ -42,7 +42,8 @@ const (
 )
 
 const (
-	tcpNetwork = "tcp"
+	tcpNetwork  = "tcp"
+	unixNetwork = "unix"
 )
 
 func hostPort(address string) string {
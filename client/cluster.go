@@ -0,0 +1,592 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClusterHashSlots is the number of Redis cluster hash slots.
+const ClusterHashSlots = 16384
+
+const (
+	maxClusterRedirects = 16
+	clusterTryAgainWait = 100 * time.Millisecond
+)
+
+// Redis cluster error codes.
+const (
+	errCodeMoved    = "MOVED"
+	errCodeAsk      = "ASK"
+	errCodeTryAgain = "TRYAGAIN"
+)
+
+const (
+	cmdFlagMovableKeys = "movablekeys"
+)
+
+// ErrClusterNoNode is returned if no cluster node is available for a command.
+var ErrClusterNoNode = errors.New(ClientName + ": cluster: no node available")
+
+// ClusterDB is a database connected to a Redis cluster.
+// Commands are routed to the master node serving the hash slot of the command keys.
+// MOVED and ASK redirections are followed transparently.
+type ClusterDB interface {
+	Commands
+	// WithContext returns the database commands bound to ctx.
+	WithContext(ctx context.Context) Commands
+	// Reload refreshes the cluster topology (slot to node mapping).
+	Reload(ctx context.Context) error
+	Close() error
+	private() // private interface
+}
+
+// OpenClusterDB opens a new cluster database.
+// The addresses are used to load the initial cluster topology.
+func OpenClusterDB(addrs []string, dialer Dialer) ClusterDB {
+	return newClusterDB(addrs, dialer)
+}
+
+// check interface implementations.
+var (
+	_ ClusterDB = (*clusterDB)(nil)
+)
+
+// keyPos represents the key positions of a command (please see Redis COMMAND).
+type keyPos struct {
+	first, last, step int
+	movable           bool
+}
+
+type clusterDB struct {
+	addrs  []string // seed addresses
+	dialer Dialer
+	closed int32
+
+	mu      sync.RWMutex
+	nodes   map[string]*db // connection pool per node address
+	slots   []string       // slot to master node address - nil if topology is not loaded
+	keyPos  map[string]keyPos
+	loadMu  sync.Mutex // serialize topology reload
+	loading int32      // atomic access - asynchronous reload in progress
+
+	*command
+}
+
+func newClusterDB(addrs []string, dialer Dialer) *clusterDB {
+	c := &clusterDB{
+		addrs:  addrs,
+		dialer: dialer,
+		nodes:  make(map[string]*db),
+	}
+	c.command = newCommand(c.send, nil)
+	return c
+}
+
+func (c *clusterDB) private() {} // private interface
+
+func (c *clusterDB) WithContext(ctx context.Context) Commands {
+	return newCommand(contextSend(ctx, c.send), nil)
+}
+
+func (c *clusterDB) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return ErrDBClosed
+	}
+	c.mu.Lock()
+	nodes := c.nodes
+	c.nodes = make(map[string]*db)
+	c.mu.Unlock()
+
+	for _, node := range nodes {
+		node.close()
+	}
+	return nil
+}
+
+func (c *clusterDB) Reload(ctx context.Context) error {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	return c.loadLocked(ctx)
+}
+
+// reloadAsync refreshes the cluster topology in the background.
+func (c *clusterDB) reloadAsync() {
+	if !atomic.CompareAndSwapInt32(&c.loading, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.loading, 0)
+		c.Reload(context.Background())
+	}()
+}
+
+// ensureLoaded loads the cluster topology if not loaded yet.
+func (c *clusterDB) ensureLoaded(ctx context.Context) error {
+	c.mu.RLock()
+	loaded := c.slots != nil
+	c.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+
+	c.mu.RLock()
+	loaded = c.slots != nil
+	c.mu.RUnlock()
+	if loaded { // loaded in the meanwhile
+		return nil
+	}
+	return c.loadLocked(ctx)
+}
+
+// loadAddrs returns the known node addresses followed by the seed addresses.
+func (c *clusterDB) loadAddrs() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	addrs := make([]string, 0, len(c.nodes)+len(c.addrs))
+	for addr := range c.nodes {
+		addrs = append(addrs, addr)
+	}
+	return append(addrs, c.addrs...)
+}
+
+func (c *clusterDB) loadLocked(ctx context.Context) error {
+	err := ErrClusterNoNode
+	for _, addr := range c.loadAddrs() {
+		var slots []string
+		if slots, err = c.loadSlots(ctx, addr); err != nil {
+			continue
+		}
+		var keyPos map[string]keyPos
+		if keyPos, err = c.loadKeyPos(ctx, addr); err != nil {
+			continue
+		}
+		c.setTopology(slots, keyPos)
+		return nil
+	}
+	return err
+}
+
+func (c *clusterDB) setTopology(slots []string, keyPos map[string]keyPos) {
+	masters := make(map[string]bool)
+	for _, addr := range slots {
+		masters[addr] = true
+	}
+
+	var obsolete []*db
+
+	c.mu.Lock()
+	c.slots = slots
+	c.keyPos = keyPos
+	for addr, node := range c.nodes {
+		if !masters[addr] {
+			obsolete = append(obsolete, node)
+			delete(c.nodes, addr)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, node := range obsolete {
+		node.close()
+	}
+}
+
+func (c *clusterDB) loadSlots(ctx context.Context, addr string) ([]string, error) {
+	node, err := c.node(addr)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := node.WithContext(ctx).ClusterSlots().ToSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+
+	slots := make([]string, ClusterHashSlots)
+	for _, v := range ranges {
+		r, err := v.ToSlice()
+		if err != nil {
+			return nil, err
+		}
+		if len(r) < 3 {
+			return nil, fmt.Errorf("cluster: invalid slot range %v", r)
+		}
+		start, err := r[0].ToInt64()
+		if err != nil {
+			return nil, err
+		}
+		end, err := r[1].ToInt64()
+		if err != nil {
+			return nil, err
+		}
+		master, err := r[2].ToSlice()
+		if err != nil {
+			return nil, err
+		}
+		if len(master) < 2 || start < 0 || end >= ClusterHashSlots || start > end {
+			return nil, fmt.Errorf("cluster: invalid slot range %v", r)
+		}
+		masterHost, err := master[0].ToString()
+		if err != nil {
+			return nil, err
+		}
+		if masterHost == "" { // unknown endpoint - use host of queried node
+			masterHost = host
+		}
+		masterPort, err := master[1].ToInt64()
+		if err != nil {
+			return nil, err
+		}
+		masterAddr := net.JoinHostPort(masterHost, strconv.FormatInt(masterPort, 10))
+		for i := start; i <= end; i++ {
+			slots[i] = masterAddr
+		}
+	}
+	return slots, nil
+}
+
+func (c *clusterDB) loadKeyPos(ctx context.Context, addr string) (map[string]keyPos, error) {
+	node, err := c.node(addr)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := node.WithContext(ctx).Command().ToSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]keyPos, len(infos))
+	for _, v := range infos {
+		info, err := v.ToSlice()
+		if err != nil {
+			return nil, err
+		}
+		if len(info) < 6 {
+			return nil, fmt.Errorf("cluster: invalid command info %v", info)
+		}
+		name, err := info[0].ToString()
+		if err != nil {
+			return nil, err
+		}
+		var kp keyPos
+		var pos [3]int64
+		for i := range pos {
+			if pos[i], err = info[3+i].ToInt64(); err != nil {
+				return nil, err
+			}
+		}
+		kp.first, kp.last, kp.step = int(pos[0]), int(pos[1]), int(pos[2])
+		if flags, err := info[2].ToStringSet(); err == nil {
+			kp.movable = flags[cmdFlagMovableKeys]
+		}
+		m[strings.ToLower(name)] = kp
+	}
+	return m, nil
+}
+
+// node returns the connection pool of a node.
+func (c *clusterDB) node(addr string) (*db, error) {
+	if atomic.LoadInt32(&c.closed) != 0 {
+		return nil, ErrDBClosed
+	}
+
+	c.mu.RLock()
+	node, ok := c.nodes[addr]
+	c.mu.RUnlock()
+	if ok {
+		return node, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node, ok = c.nodes[addr]; !ok {
+		node = newDB(addr, c.dialer)
+		c.nodes[addr] = node
+	}
+	return node, nil
+}
+
+// anyNode returns the address of an arbitrary cluster node.
+func (c *clusterDB) anyNode() (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for addr := range c.nodes {
+		return addr, nil
+	}
+	for _, addr := range c.slots {
+		if addr != "" {
+			return addr, nil
+		}
+	}
+	return "", ErrClusterNoNode
+}
+
+// route returns the address of the master node serving the command.
+func (c *clusterDB) route(ctx context.Context, cmd []interface{}) (string, error) {
+	if err := c.ensureLoaded(ctx); err != nil {
+		return "", err
+	}
+	key, ok, err := c.commandKey(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return c.anyNode()
+	}
+
+	c.mu.RLock()
+	addr := c.slots[keySlot(key)]
+	c.mu.RUnlock()
+	if addr == "" {
+		return c.anyNode()
+	}
+	return addr, nil
+}
+
+// commandKey returns the first key of the command.
+func (c *clusterDB) commandKey(ctx context.Context, cmd []interface{}) (string, bool, error) {
+	if len(cmd) == 0 {
+		return "", false, nil
+	}
+	name, ok := tokenString(cmd[0])
+	if !ok {
+		return "", false, nil
+	}
+
+	c.mu.RLock()
+	kp, ok := c.keyPos[strings.ToLower(name)]
+	c.mu.RUnlock()
+
+	switch {
+	case !ok:
+		return "", false, nil
+	case kp.movable:
+		return c.commandGetkeys(ctx, cmd)
+	case kp.first <= 0 || kp.first >= len(cmd):
+		return "", false, nil
+	}
+	key, ok := tokenString(cmd[kp.first])
+	return key, ok, nil
+}
+
+// commandGetkeys extracts the command keys via the Redis COMMAND GETKEYS command.
+func (c *clusterDB) commandGetkeys(ctx context.Context, cmd []interface{}) (string, bool, error) {
+	addr, err := c.anyNode()
+	if err != nil {
+		return "", false, err
+	}
+	node, err := c.node(addr)
+	if err != nil {
+		return "", false, err
+	}
+	keys, err := node.WithContext(ctx).CommandGetkeys(cmd).ToStringSlice()
+	if err != nil || len(keys) == 0 { // no keys
+		return "", false, nil
+	}
+	return keys[0], true, nil
+}
+
+func (c *clusterDB) setSlot(slot int, addr string) {
+	c.mu.Lock()
+	if c.slots != nil {
+		c.slots[slot] = addr
+	}
+	c.mu.Unlock()
+}
+
+func (c *clusterDB) send(name string, r *result) {
+	if atomic.LoadInt32(&c.closed) != 0 {
+		r.setErr(ErrDBClosed)
+		return
+	}
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	addr, err := c.route(ctx, r.cmd())
+	if err != nil {
+		r.setErr(err)
+		return
+	}
+	r.flush()
+	c.exec(ctx, name, addr, r, false, 0)
+}
+
+// exec executes the command on the node addr. Cluster redirections are followed when the node
+// result is acknowledged (please see reply).
+func (c *clusterDB) exec(ctx context.Context, name, addr string, r *result, asking bool, redirects int) {
+	node, err := c.node(addr)
+	if err != nil {
+		c.reply(ctx, name, addr, r, redirects, nil, err)
+		return
+	}
+
+	nr := newResult()
+	nr.request.copyFrom(r.request)
+	nr.ctx = r.ctx
+
+	done := func() { c.reply(ctx, name, addr, r, redirects, nr.value, nr.err) }
+
+	if !asking {
+		sendNotify(node.send, name, nr, done)
+		return
+	}
+
+	// ASKING needs to be send on the same connection right before the command
+	conn, err := node.getConn(ctx)
+	if err != nil {
+		c.reply(ctx, name, addr, r, redirects, nil, err)
+		return
+	}
+	p := newPipeline(conn)
+	p.Do("asking")
+	sendNotify(p.send, name, nr, done)
+	p.Flush() // errors are set on the results
+	node.releaseConn(conn)
+}
+
+// reply acknowledges r with the node reply. In case of a cluster redirection the command is
+// executed again by a new goroutine, so that the connection handler acknowledging the node
+// result is not blocked.
+func (c *clusterDB) reply(ctx context.Context, name, addr string, r *result, redirects int, value RedisValue, err error) {
+	if redirects+1 >= maxClusterRedirects || !c.isRedirect(err) {
+		r.ack(value, err)
+		return
+	}
+	go c.redirect(ctx, name, addr, r, redirects+1, err)
+}
+
+// isRedirect returns true if the command needs to be executed again because of err.
+func (c *clusterDB) isRedirect(err error) bool {
+	if err == ErrDBClosed { // node removed by reload
+		return atomic.LoadInt32(&c.closed) == 0
+	}
+	redisErr, ok := err.(*RedisError)
+	if !ok {
+		return false
+	}
+	switch redisErr.Code {
+	case errCodeMoved, errCodeAsk:
+		_, _, ok := parseRedirect(redisErr.Msg)
+		return ok
+	case errCodeTryAgain:
+		return true
+	default:
+		return false
+	}
+}
+
+// redirect executes the command again following the cluster redirection err.
+func (c *clusterDB) redirect(ctx context.Context, name, addr string, r *result, redirects int, err error) {
+	redisErr, ok := err.(*RedisError)
+	if !ok { // node removed by reload
+		if addr, err = c.route(ctx, r.cmd()); err != nil {
+			r.ack(nil, err)
+			return
+		}
+		c.exec(ctx, name, addr, r, false, redirects)
+		return
+	}
+
+	switch redisErr.Code {
+	case errCodeMoved:
+		slot, movedAddr, _ := parseRedirect(redisErr.Msg)
+		c.setSlot(slot, movedAddr)
+		c.reloadAsync()
+		c.exec(ctx, name, movedAddr, r, false, redirects)
+	case errCodeAsk:
+		_, askAddr, _ := parseRedirect(redisErr.Msg)
+		c.exec(ctx, name, askAddr, r, true, redirects)
+	case errCodeTryAgain: // multi-key command during resharding
+		t := time.NewTimer(clusterTryAgainWait)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			r.ack(nil, ctx.Err())
+		case <-t.C:
+			c.exec(ctx, name, addr, r, false, redirects)
+		}
+	}
+}
+
+// parseRedirect parses a MOVED or ASK error message '<slot> <address>'.
+func parseRedirect(msg string) (int, string, bool) {
+	parts := strings.Fields(msg)
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+	slot, err := strconv.Atoi(parts[0])
+	if err != nil || slot < 0 || slot >= ClusterHashSlots {
+		return 0, "", false
+	}
+	return slot, parts[1], true
+}
+
+// tokenString returns the string representation of a command token.
+func tokenString(v interface{}) (string, bool) {
+	s, err := argString(v)
+	return s, err == nil
+}
+
+// keySlot returns the cluster hash slot of a key.
+// In case the key contains a hash tag ({...}) only the hash tag is hashed.
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % ClusterHashSlots)
+}
+
+var crc16Table [256]uint16
+
+func init() {
+	const poly = 0x1021 // CRC16-CCITT (XMODEM)
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeySlot(t *testing.T) {
+	if crc := crc16("123456789"); crc != 0x31c3 {
+		t.Fatalf("got: %x expected: %x", crc, 0x31c3)
+	}
+
+	var tests = []struct {
+		key  string
+		hash string
+	}{
+		{"foo", "foo"},
+		{"{user1000}.following", "user1000"},
+		{"{user1000}.followers", "user1000"},
+		{"foo{}{bar}", "foo{}{bar}"},
+		{"foo{{bar}}zap", "{bar"},
+		{"foo{bar}{zap}", "bar"},
+	}
+
+	for i, test := range tests {
+		if slot, expected := keySlot(test.key), int(crc16(test.hash)%ClusterHashSlots); slot != expected {
+			t.Fatalf("line: %d got: %d expected: %d", i, slot, expected)
+		}
+	}
+	if slot := keySlot("foo"); slot != 12182 {
+		t.Fatalf("got: %d expected: %d", slot, 12182)
+	}
+}
+
+// fakeClusterNode lets a fake server act as cluster master node for a slot range.
+type fakeClusterNode struct {
+	*fakeServer
+	first, last int
+
+	mu     sync.Mutex
+	asking map[net.Conn]bool
+}
+
+func writeSlotRange(w *bufio.Writer, first, last int, addr string) {
+	host, port, _ := net.SplitHostPort(addr)
+	fmt.Fprintf(w, "*3\r\n:%d\r\n:%d\r\n*2\r\n", first, last)
+	bulk(w, host)
+	fmt.Fprintf(w, ":%s\r\n", port)
+}
+
+func TestClusterDB(t *testing.T) {
+	nodes := []*fakeClusterNode{
+		{fakeServer: newFakeServer(t), first: 0, last: 8191, asking: map[net.Conn]bool{}},
+		{fakeServer: newFakeServer(t), first: 8192, last: 16383, asking: map[net.Conn]bool{}},
+	}
+	defer nodes[0].ln.Close()
+	defer nodes[1].ln.Close()
+
+	const (
+		migratingKey  = "migrating"
+		reshardingKey = "resharding"
+	)
+
+	var mu sync.Mutex
+	stale := true // first topology request gets a stale slot mapping
+
+	owner := func(slot int) *fakeClusterNode {
+		for _, node := range nodes {
+			if slot >= node.first && slot <= node.last {
+				return node
+			}
+		}
+		return nil
+	}
+
+	for _, node := range nodes {
+		node := node
+		node.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+			node.mu.Lock()
+			asking := node.asking[c]
+			delete(node.asking, c)
+			node.mu.Unlock()
+
+			switch strings.ToUpper(cmd[0]) {
+			case "CLUSTER":
+				mu.Lock()
+				isStale := stale
+				stale = false
+				mu.Unlock()
+				if isStale {
+					w.WriteString("*1\r\n")
+					writeSlotRange(w, 0, 16383, nodes[0].addr())
+				} else {
+					w.WriteString("*2\r\n")
+					for _, node := range nodes {
+						writeSlotRange(w, node.first, node.last, node.addr())
+					}
+				}
+			case "COMMAND":
+				w.WriteString("*2\r\n")
+				for _, name := range []string{"get", "set"} {
+					w.WriteString("*6\r\n")
+					bulk(w, name)
+					w.WriteString(":-2\r\n~0\r\n:1\r\n:1\r\n:1\r\n")
+				}
+			case "ASKING":
+				node.mu.Lock()
+				node.asking[c] = true
+				node.mu.Unlock()
+				w.WriteString("+OK\r\n")
+			case "GET", "SET":
+				slot := keySlot(cmd[1])
+				switch {
+				case cmd[1] == reshardingKey:
+					w.WriteString("-TRYAGAIN Multiple keys request during rehashing of slot\r\n")
+				case cmd[1] == migratingKey && node == nodes[0]:
+					fmt.Fprintf(w, "-ASK %d %s\r\n", slot, nodes[1].addr())
+				case cmd[1] == migratingKey && node == nodes[1] && !asking:
+					fmt.Fprintf(w, "-MOVED %d %s\r\n", slot, nodes[0].addr())
+				case cmd[1] != migratingKey && owner(slot) != node:
+					fmt.Fprintf(w, "-MOVED %d %s\r\n", slot, owner(slot).addr())
+				default:
+					return false
+				}
+			default:
+				return false
+			}
+			return true
+		}
+	}
+
+	db := OpenClusterDB([]string{nodes[0].addr()}, Dialer{})
+	defer db.Close()
+
+	keys := []string{"foo", "bar", "{user1000}.following", migratingKey}
+	for _, key := range keys {
+		if err := db.Set(key, "value-"+key).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range keys {
+		v, err := db.Get(key).ToString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "value-"+key {
+			t.Fatalf("got: %s expected: %s", v, "value-"+key)
+		}
+		node := owner(keySlot(key))
+		if key == migratingKey {
+			node = nodes[1]
+		}
+		node.fakeServer.mu.Lock()
+		_, ok := node.kv[key]
+		node.fakeServer.mu.Unlock()
+		if !ok {
+			t.Fatalf("key %s not stored on node %s", key, node.addr())
+		}
+	}
+
+	// reply written to writer (redirected and asking)
+	for _, key := range []string{"foo", migratingKey} {
+		var b bytes.Buffer
+		if err := db.GetTo(key, &b).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != "value-"+key {
+			t.Fatalf("got: %s expected: %s", b.String(), "value-"+key)
+		}
+	}
+
+	// TRYAGAIN retries are stopped when the context is done
+	countGets := func() int { return nodes[0].countCmds("GET RESHARDING") + nodes[1].countCmds("GET RESHARDING") }
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := db.WithContext(ctx).Get(reshardingKey).Err(); err != context.DeadlineExceeded {
+		t.Fatalf("got: %v expected: %v", err, context.DeadlineExceeded)
+	}
+	n := countGets()
+	time.Sleep(3 * clusterTryAgainWait)
+	if m := countGets(); m != n {
+		t.Fatalf("got: %d expected: %d retries after context is done", m-n, 0)
+	}
+}
@@ -16,6 +16,10 @@ limitations under the License.
 
 package client
 
+import (
+	"context"
+)
+
 //go:generate commander
 
 type command struct {
@@ -32,5 +36,18 @@ func newCommand(send sendFct, sendInterceptor SendInterceptor) *command {
 	}}
 }
 
+// contextSend binds ctx to the results of send.
+// Results of commands sent after ctx is done are failing with ctx.Err().
+func contextSend(ctx context.Context, send sendFct) sendFct {
+	return func(name string, r *result) {
+		if err := ctx.Err(); err != nil {
+			r.setErr(err)
+			return
+		}
+		r.ctx = ctx
+		send(name, r)
+	}
+}
+
 // check interface implementations.
 var _ Commands = (*command)(nil)
@@ -120,6 +120,8 @@ type Commands interface {
 	StreamCommands
 	StringCommands
 	TransactionsCommands
+	HashStructCommands
+	BulkCommands
 }
 type ClusterCommands interface {
 	ClusterAddslots(slot []int64) Result
@@ -254,8 +256,13 @@ type PubsubCommands interface {
 	PubsubChannels(pattern *string) Result
 	PubsubNumpat() Result
 	PubsubNumsub(channel []string) Result
+	PubsubShardchannels(pattern *string) Result
+	PubsubShardnumsub(shardchannel []string) Result
 	Punsubscribe(pattern []string) Result
+	Spublish(shardchannel, message string) Result
+	Ssubscribe(shardchannel []string, cb MsgCallback) Result
 	Subscribe(channel []string, cb MsgCallback) Result
+	Sunsubscribe(shardchannel []string) Result
 	Unsubscribe(channel []string) Result
 }
 type ScriptingCommands interface {
@@ -2889,6 +2896,40 @@ func (c *command) PubsubNumsub(channel []string) Result {
 	return r
 }
 
+// PubsubShardchannels - List active shard channels
+// Group: pubsub
+// Since: 7.0.0
+// Complexity:
+// O(N) where N is the number of active shard channels, and assuming constant time
+// pattern matching (relatively short shard channels).
+func (c *command) PubsubShardchannels(pattern *string) Result {
+	r := newResult()
+	r.request.cmd = append(r.request.cmd, "PUBSUB", "SHARDCHANNELS")
+	if pattern != nil {
+		r.request.cmd = append(r.request.cmd, pattern)
+	}
+	c.send(CmdPubsubShardchannels, r)
+	return r
+}
+
+// PubsubShardnumsub - Get the count of subscribers for shard channels
+// Group: pubsub
+// Since: 7.0.0
+// Complexity: O(N) for the SHARDNUMSUB subcommand, where N is the number of requested shard channels
+func (c *command) PubsubShardnumsub(shardchannel []string) Result {
+	r := newResult()
+	if shardchannel == nil {
+		r.setErr(newInvalidValueError("shardchannel", nil))
+		return r
+	}
+	r.request.cmd = append(r.request.cmd, "PUBSUB", "SHARDNUMSUB")
+	for _, v := range shardchannel {
+		r.request.cmd = append(r.request.cmd, v)
+	}
+	c.send(CmdPubsubShardnumsub, r)
+	return r
+}
+
 // Punsubscribe - Stop listening for messages posted to channels matching the given patterns
 // Group: pubsub
 // Since: 2.0.0
@@ -3554,6 +3595,17 @@ func (c *command) Spop(key interface{}, count *int64) Result {
 	return r
 }
 
+// Spublish - Post a message to a shard channel
+// Group: pubsub
+// Since: 7.0.0
+// Complexity: O(N) where N is the number of clients subscribed to the receiving shard channel.
+func (c *command) Spublish(shardchannel, message string) Result {
+	r := newResult()
+	r.request.cmd = append(r.request.cmd, "SPUBLISH", shardchannel, message)
+	c.send(CmdSpublish, r)
+	return r
+}
+
 // Srandmember - Get one or multiple random members from a set
 // Group: set
 // Since: 1.0.0
@@ -3608,6 +3660,25 @@ func (c *command) Sscan(key interface{}, cursor int64, match *string, count *int
 	return r
 }
 
+// Ssubscribe - Listen for messages published to the given shard channels
+// Group: pubsub
+// Since: 7.0.0
+// Complexity: O(N) where N is the number of shard channels to subscribe to.
+func (c *command) Ssubscribe(shardchannel []string, cb MsgCallback) Result {
+	r := newResult()
+	if shardchannel == nil {
+		r.setErr(newInvalidValueError("shardchannel", nil))
+		return r
+	}
+	r.request.cmd = append(r.request.cmd, "SSUBSCRIBE")
+	for _, v := range shardchannel {
+		r.request.cmd = append(r.request.cmd, v)
+	}
+	r.request.cb = cb
+	c.send(CmdSsubscribe, r)
+	return r
+}
+
 // StralgoLcsIdxKeys - Run algorithms (currently LCS) against strings
 // Group: string
 // Since: 6.0.0
@@ -3752,6 +3823,20 @@ func (c *command) Sunionstore(destination interface{}, key []interface{}) Result
 	return r
 }
 
+// Sunsubscribe - Stop listening for messages posted to the given shard channels
+// Group: pubsub
+// Since: 7.0.0
+// Complexity: O(N) where N is the number of clients already subscribed to a shard channel.
+func (c *command) Sunsubscribe(shardchannel []string) Result {
+	r := newResult()
+	r.request.cmd = append(r.request.cmd, "SUNSUBSCRIBE")
+	for _, v := range shardchannel {
+		r.request.cmd = append(r.request.cmd, v)
+	}
+	c.send(CmdSunsubscribe, r)
+	return r
+}
+
 // Swapdb - Swaps two Redis databases
 // Group: server
 // Since: 4.0.0
@@ -4734,7 +4819,7 @@ const (
 	GroupTransactions = "Transactions"
 )
 
-var Groups = map[string][]string{GroupCluster: {CmdClusterAddslots, CmdClusterBumpepoch, CmdClusterCountFailureReports, CmdClusterCountkeysinslot, CmdClusterDelslots, CmdClusterFailover, CmdClusterFlushslots, CmdClusterForget, CmdClusterGetkeysinslot, CmdClusterInfo, CmdClusterKeyslot, CmdClusterMeet, CmdClusterMyid, CmdClusterNodes, CmdClusterReplicas, CmdClusterReplicate, CmdClusterReset, CmdClusterSaveconfig, CmdClusterSetConfigEpoch, CmdClusterSetslotImporting, CmdClusterSetslotMigrating, CmdClusterSetslotNode, CmdClusterSetslotStable, CmdClusterSlots, CmdReadonly, CmdReadwrite}, GroupConnection: {CmdAuth, CmdClientCaching, CmdClientGetname, CmdClientGetredir, CmdClientId, CmdClientKill, CmdClientList, CmdClientPause, CmdClientReply, CmdClientSetname, CmdClientTracking, CmdClientUnblock, CmdEcho, CmdHello, CmdPing, CmdQuit, CmdSelect}, GroupGeneric: {CmdDel, CmdDo, CmdDump, CmdExists, CmdExpire, CmdExpireat, CmdKeys, CmdMigrate, CmdMove, CmdObjectEncoding, CmdObjectFreq, CmdObjectHelp, CmdObjectIdletime, CmdObjectRefcount, CmdPTTL, CmdPersist, CmdPexpire, CmdPexpireat, CmdRandomkey, CmdRename, CmdRenameNx, CmdRestore, CmdScan, CmdSort, CmdTTL, CmdTouch, CmdType, CmdUnlink, CmdWait}, GroupGeo: {CmdGeoadd, CmdGeodist, CmdGeohash, CmdGeopos, CmdGeoradius, CmdGeoradiusbymember}, GroupHash: {CmdHdel, CmdHexists, CmdHget, CmdHgetall, CmdHincrby, CmdHincrbyfloat, CmdHkeys, CmdHlen, CmdHmget, CmdHscan, CmdHset, CmdHsetNx, CmdHstrlen, CmdHvals}, GroupHyperloglog: {CmdPfadd, CmdPfcount, CmdPfmerge}, GroupList: {CmdBlpop, CmdBrpop, CmdBrpoplpush, CmdLindex, CmdLinsert, CmdLlen, CmdLpop, CmdLpos, CmdLpush, CmdLpushx, CmdLrange, CmdLrem, CmdLset, CmdLtrim, CmdRpop, CmdRpoplpush, CmdRpush, CmdRpushx}, GroupPubsub: {CmdPsubscribe, CmdPublish, CmdPubsubChannels, CmdPubsubNumpat, CmdPubsubNumsub, CmdPunsubscribe, CmdSubscribe, CmdUnsubscribe}, GroupScripting: {CmdEval, CmdEvalsha, CmdScriptDebug, CmdScriptExists, CmdScriptFlush, CmdScriptKill, CmdScriptLoad}, GroupServer: {CmdAclCat, CmdAclDeluser, CmdAclGenpass, CmdAclGetuser, CmdAclHelp, CmdAclList, CmdAclLoad, CmdAclLogCount, CmdAclLogReset, CmdAclSave, CmdAclSetuser, CmdAclUsers, CmdAclWhoami, CmdBgrewriteaof, CmdBgsave, CmdCommand, CmdCommandCount, CmdCommandGetkeys, CmdCommandInfo, CmdConfigGet, CmdConfigResetstat, CmdConfigRewrite, CmdConfigSet, CmdDbsize, CmdDebugObject, CmdDebugSegfault, CmdFlushall, CmdFlushdb, CmdInfo, CmdLastsave, CmdLatencyDoctor, CmdLatencyGraph, CmdLatencyHelp, CmdLatencyHistory, CmdLatencyLatest, CmdLatencyReset, CmdLolwut, CmdMemoryDoctor, CmdMemoryHelp, CmdMemoryMallocStats, CmdMemoryPurge, CmdMemoryStats, CmdMemoryUsage, CmdModuleList, CmdModuleLoad, CmdModuleUnload, CmdMonitor, CmdPsync, CmdReplicaof, CmdRole, CmdSave, CmdShutdown, CmdSlowlogGet, CmdSlowlogLen, CmdSlowlogReset, CmdSwapdb, CmdTime}, GroupSet: {CmdSadd, CmdScard, CmdSdiff, CmdSdiffstore, CmdSinter, CmdSinterstore, CmdSismember, CmdSmembers, CmdSmove, CmdSpop, CmdSrandmember, CmdSrem, CmdSscan, CmdSunion, CmdSunionstore}, GroupSortedSet: {CmdBzpopmax, CmdBzpopmin, CmdZadd, CmdZaddCh, CmdZaddNx, CmdZaddXx, CmdZaddXxCh, CmdZcard, CmdZcount, CmdZincrby, CmdZinterstore, CmdZlexcount, CmdZpopmax, CmdZpopmin, CmdZrange, CmdZrangebylex, CmdZrangebyscore, CmdZrank, CmdZrem, CmdZremrangebylex, CmdZremrangebyrank, CmdZremrangebyscore, CmdZrevrange, CmdZrevrangebylex, CmdZrevrangebyscore, CmdZrevrank, CmdZscan, CmdZscore, CmdZunionstore}, GroupStream: {CmdXack, CmdXadd, CmdXclaim, CmdXdel, CmdXgroupCreate, CmdXgroupDelconsumer, CmdXgroupDestroy, CmdXgroupHelp, CmdXgroupSetid, CmdXinfoConsumers, CmdXinfoGroups, CmdXinfoHelp, CmdXinfoStream, CmdXlen, CmdXpending, CmdXrange, CmdXread, CmdXreadgroup, CmdXrevrange, CmdXtrim}, GroupString: {CmdAppend, CmdBitcount, CmdBitfield, CmdBitopAnd, CmdBitopNot, CmdBitopOr, CmdBitopXor, CmdBitpos, CmdDecr, CmdDecrby, CmdGet, CmdGetbit, CmdGetrange, CmdGetset, CmdIncr, CmdIncrby, CmdIncrbyfloat, CmdMget, CmdMset, CmdMsetNx, CmdSet, CmdSetEx, CmdSetExNx, CmdSetExXx, CmdSetNx, CmdSetPx, CmdSetPxNx, CmdSetPxXx, CmdSetXx, CmdSetbit, CmdSetrange, CmdStralgoLcsIdxKeys, CmdStralgoLcsIdxStrings, CmdStralgoLcsKeys, CmdStralgoLcsLenKeys, CmdStralgoLcsLenStrings, CmdStralgoLcsStrings, CmdStrlen}, GroupTransactions: {CmdDiscard, CmdExec, CmdMulti, CmdUnwatch, CmdWatch},
+var Groups = map[string][]string{GroupCluster: {CmdClusterAddslots, CmdClusterBumpepoch, CmdClusterCountFailureReports, CmdClusterCountkeysinslot, CmdClusterDelslots, CmdClusterFailover, CmdClusterFlushslots, CmdClusterForget, CmdClusterGetkeysinslot, CmdClusterInfo, CmdClusterKeyslot, CmdClusterMeet, CmdClusterMyid, CmdClusterNodes, CmdClusterReplicas, CmdClusterReplicate, CmdClusterReset, CmdClusterSaveconfig, CmdClusterSetConfigEpoch, CmdClusterSetslotImporting, CmdClusterSetslotMigrating, CmdClusterSetslotNode, CmdClusterSetslotStable, CmdClusterSlots, CmdReadonly, CmdReadwrite}, GroupConnection: {CmdAuth, CmdClientCaching, CmdClientGetname, CmdClientGetredir, CmdClientId, CmdClientKill, CmdClientList, CmdClientPause, CmdClientReply, CmdClientSetname, CmdClientTracking, CmdClientUnblock, CmdEcho, CmdHello, CmdPing, CmdQuit, CmdSelect}, GroupGeneric: {CmdDel, CmdDo, CmdDump, CmdExists, CmdExpire, CmdExpireat, CmdKeys, CmdMigrate, CmdMove, CmdObjectEncoding, CmdObjectFreq, CmdObjectHelp, CmdObjectIdletime, CmdObjectRefcount, CmdPTTL, CmdPersist, CmdPexpire, CmdPexpireat, CmdRandomkey, CmdRename, CmdRenameNx, CmdRestore, CmdScan, CmdSort, CmdTTL, CmdTouch, CmdType, CmdUnlink, CmdWait}, GroupGeo: {CmdGeoadd, CmdGeodist, CmdGeohash, CmdGeopos, CmdGeoradius, CmdGeoradiusbymember}, GroupHash: {CmdHdel, CmdHexists, CmdHget, CmdHgetall, CmdHincrby, CmdHincrbyfloat, CmdHkeys, CmdHlen, CmdHmget, CmdHscan, CmdHset, CmdHsetNx, CmdHstrlen, CmdHvals}, GroupHyperloglog: {CmdPfadd, CmdPfcount, CmdPfmerge}, GroupList: {CmdBlpop, CmdBrpop, CmdBrpoplpush, CmdLindex, CmdLinsert, CmdLlen, CmdLpop, CmdLpos, CmdLpush, CmdLpushx, CmdLrange, CmdLrem, CmdLset, CmdLtrim, CmdRpop, CmdRpoplpush, CmdRpush, CmdRpushx}, GroupPubsub: {CmdPsubscribe, CmdPublish, CmdPubsubChannels, CmdPubsubNumpat, CmdPubsubNumsub, CmdPubsubShardchannels, CmdPubsubShardnumsub, CmdPunsubscribe, CmdSpublish, CmdSsubscribe, CmdSubscribe, CmdSunsubscribe, CmdUnsubscribe}, GroupScripting: {CmdEval, CmdEvalsha, CmdScriptDebug, CmdScriptExists, CmdScriptFlush, CmdScriptKill, CmdScriptLoad}, GroupServer: {CmdAclCat, CmdAclDeluser, CmdAclGenpass, CmdAclGetuser, CmdAclHelp, CmdAclList, CmdAclLoad, CmdAclLogCount, CmdAclLogReset, CmdAclSave, CmdAclSetuser, CmdAclUsers, CmdAclWhoami, CmdBgrewriteaof, CmdBgsave, CmdCommand, CmdCommandCount, CmdCommandGetkeys, CmdCommandInfo, CmdConfigGet, CmdConfigResetstat, CmdConfigRewrite, CmdConfigSet, CmdDbsize, CmdDebugObject, CmdDebugSegfault, CmdFlushall, CmdFlushdb, CmdInfo, CmdLastsave, CmdLatencyDoctor, CmdLatencyGraph, CmdLatencyHelp, CmdLatencyHistory, CmdLatencyLatest, CmdLatencyReset, CmdLolwut, CmdMemoryDoctor, CmdMemoryHelp, CmdMemoryMallocStats, CmdMemoryPurge, CmdMemoryStats, CmdMemoryUsage, CmdModuleList, CmdModuleLoad, CmdModuleUnload, CmdMonitor, CmdPsync, CmdReplicaof, CmdRole, CmdSave, CmdShutdown, CmdSlowlogGet, CmdSlowlogLen, CmdSlowlogReset, CmdSwapdb, CmdTime}, GroupSet: {CmdSadd, CmdScard, CmdSdiff, CmdSdiffstore, CmdSinter, CmdSinterstore, CmdSismember, CmdSmembers, CmdSmove, CmdSpop, CmdSrandmember, CmdSrem, CmdSscan, CmdSunion, CmdSunionstore}, GroupSortedSet: {CmdBzpopmax, CmdBzpopmin, CmdZadd, CmdZaddCh, CmdZaddNx, CmdZaddXx, CmdZaddXxCh, CmdZcard, CmdZcount, CmdZincrby, CmdZinterstore, CmdZlexcount, CmdZpopmax, CmdZpopmin, CmdZrange, CmdZrangebylex, CmdZrangebyscore, CmdZrank, CmdZrem, CmdZremrangebylex, CmdZremrangebyrank, CmdZremrangebyscore, CmdZrevrange, CmdZrevrangebylex, CmdZrevrangebyscore, CmdZrevrank, CmdZscan, CmdZscore, CmdZunionstore}, GroupStream: {CmdXack, CmdXadd, CmdXclaim, CmdXdel, CmdXgroupCreate, CmdXgroupDelconsumer, CmdXgroupDestroy, CmdXgroupHelp, CmdXgroupSetid, CmdXinfoConsumers, CmdXinfoGroups, CmdXinfoHelp, CmdXinfoStream, CmdXlen, CmdXpending, CmdXrange, CmdXread, CmdXreadgroup, CmdXrevrange, CmdXtrim}, GroupString: {CmdAppend, CmdBitcount, CmdBitfield, CmdBitopAnd, CmdBitopNot, CmdBitopOr, CmdBitopXor, CmdBitpos, CmdDecr, CmdDecrby, CmdGet, CmdGetbit, CmdGetrange, CmdGetset, CmdIncr, CmdIncrby, CmdIncrbyfloat, CmdMget, CmdMset, CmdMsetNx, CmdSet, CmdSetEx, CmdSetExNx, CmdSetExXx, CmdSetNx, CmdSetPx, CmdSetPxNx, CmdSetPxXx, CmdSetXx, CmdSetbit, CmdSetrange, CmdStralgoLcsIdxKeys, CmdStralgoLcsIdxStrings, CmdStralgoLcsKeys, CmdStralgoLcsLenKeys, CmdStralgoLcsLenStrings, CmdStralgoLcsStrings, CmdStrlen}, GroupTransactions: {CmdDiscard, CmdExec, CmdMulti, CmdUnwatch, CmdWatch},
 }
 
 const (
@@ -4912,6 +4997,8 @@ const (
 	CmdPubsubChannels             = "PubsubChannels"
 	CmdPubsubNumpat               = "PubsubNumpat"
 	CmdPubsubNumsub               = "PubsubNumsub"
+	CmdPubsubShardchannels        = "PubsubShardchannels"
+	CmdPubsubShardnumsub          = "PubsubShardnumsub"
 	CmdPunsubscribe               = "Punsubscribe"
 	CmdQuit                       = "Quit"
 	CmdRandomkey                  = "Randomkey"
@@ -4960,9 +5047,11 @@ const (
 	CmdSmove                      = "Smove"
 	CmdSort                       = "Sort"
 	CmdSpop                       = "Spop"
+	CmdSpublish                   = "Spublish"
 	CmdSrandmember                = "Srandmember"
 	CmdSrem                       = "Srem"
 	CmdSscan                      = "Sscan"
+	CmdSsubscribe                 = "Ssubscribe"
 	CmdStralgoLcsIdxKeys          = "StralgoLcsIdxKeys"
 	CmdStralgoLcsIdxStrings       = "StralgoLcsIdxStrings"
 	CmdStralgoLcsKeys             = "StralgoLcsKeys"
@@ -4973,6 +5062,7 @@ const (
 	CmdSubscribe                  = "Subscribe"
 	CmdSunion                     = "Sunion"
 	CmdSunionstore                = "Sunionstore"
+	CmdSunsubscribe               = "Sunsubscribe"
 	CmdSwapdb                     = "Swapdb"
 	CmdTTL                        = "TTL"
 	CmdTime                       = "Time"
@@ -5206,6 +5296,8 @@ const (
 	CmdPubsubChannelsVersion             = "2.8.0"
 	CmdPubsubNumpatVersion               = "2.8.0"
 	CmdPubsubNumsubVersion               = "2.8.0"
+	CmdPubsubShardchannelsVersion        = "7.0.0"
+	CmdPubsubShardnumsubVersion          = "7.0.0"
 	CmdPunsubscribeVersion               = "2.0.0"
 	CmdQuitVersion                       = "1.0.0"
 	CmdRandomkeyVersion                  = "1.0.0"
@@ -5254,9 +5346,11 @@ const (
 	CmdSmoveVersion                      = "1.0.0"
 	CmdSortVersion                       = "1.0.0"
 	CmdSpopVersion                       = "1.0.0"
+	CmdSpublishVersion                   = "7.0.0"
 	CmdSrandmemberVersion                = "1.0.0"
 	CmdSremVersion                       = "1.0.0"
 	CmdSscanVersion                      = "2.8.0"
+	CmdSsubscribeVersion                 = "7.0.0"
 	CmdStralgoLcsIdxKeysVersion          = "6.0.0"
 	CmdStralgoLcsIdxStringsVersion       = "6.0.0"
 	CmdStralgoLcsKeysVersion             = "6.0.0"
@@ -5267,6 +5361,7 @@ const (
 	CmdSubscribeVersion                  = "2.0.0"
 	CmdSunionVersion                     = "1.0.0"
 	CmdSunionstoreVersion                = "1.0.0"
+	CmdSunsubscribeVersion               = "7.0.0"
 	CmdSwapdbVersion                     = "4.0.0"
 	CmdTTLVersion                        = "1.0.0"
 	CmdTimeVersion                       = "2.6.0"
@@ -5326,4 +5421,6 @@ const (
 	CmdZunionstoreVersion                = "2.0.0"
 )
 
-var CommandNames = []string{CmdAclCat, CmdAclDeluser, CmdAclGenpass, CmdAclGetuser, CmdAclHelp, CmdAclList, CmdAclLoad, CmdAclLogCount, CmdAclLogReset, CmdAclSave, CmdAclSetuser, CmdAclUsers, CmdAclWhoami, CmdAppend, CmdAuth, CmdBgrewriteaof, CmdBgsave, CmdBitcount, CmdBitfield, CmdBitopAnd, CmdBitopNot, CmdBitopOr, CmdBitopXor, CmdBitpos, CmdBlpop, CmdBrpop, CmdBrpoplpush, CmdBzpopmax, CmdBzpopmin, CmdClientCaching, CmdClientGetname, CmdClientGetredir, CmdClientId, CmdClientKill, CmdClientList, CmdClientPause, CmdClientReply, CmdClientSetname, CmdClientTracking, CmdClientUnblock, CmdClusterAddslots, CmdClusterBumpepoch, CmdClusterCountFailureReports, CmdClusterCountkeysinslot, CmdClusterDelslots, CmdClusterFailover, CmdClusterFlushslots, CmdClusterForget, CmdClusterGetkeysinslot, CmdClusterInfo, CmdClusterKeyslot, CmdClusterMeet, CmdClusterMyid, CmdClusterNodes, CmdClusterReplicas, CmdClusterReplicate, CmdClusterReset, CmdClusterSaveconfig, CmdClusterSetConfigEpoch, CmdClusterSetslotImporting, CmdClusterSetslotMigrating, CmdClusterSetslotNode, CmdClusterSetslotStable, CmdClusterSlots, CmdCommand, CmdCommandCount, CmdCommandGetkeys, CmdCommandInfo, CmdConfigGet, CmdConfigResetstat, CmdConfigRewrite, CmdConfigSet, CmdDbsize, CmdDebugObject, CmdDebugSegfault, CmdDecr, CmdDecrby, CmdDel, CmdDiscard, CmdDo, CmdDump, CmdEcho, CmdEval, CmdEvalsha, CmdExec, CmdExists, CmdExpire, CmdExpireat, CmdFlushall, CmdFlushdb, CmdGeoadd, CmdGeodist, CmdGeohash, CmdGeopos, CmdGeoradius, CmdGeoradiusbymember, CmdGet, CmdGetbit, CmdGetrange, CmdGetset, CmdHdel, CmdHello, CmdHexists, CmdHget, CmdHgetall, CmdHincrby, CmdHincrbyfloat, CmdHkeys, CmdHlen, CmdHmget, CmdHscan, CmdHset, CmdHsetNx, CmdHstrlen, CmdHvals, CmdIncr, CmdIncrby, CmdIncrbyfloat, CmdInfo, CmdKeys, CmdLastsave, CmdLatencyDoctor, CmdLatencyGraph, CmdLatencyHelp, CmdLatencyHistory, CmdLatencyLatest, CmdLatencyReset, CmdLindex, CmdLinsert, CmdLlen, CmdLolwut, CmdLpop, CmdLpos, CmdLpush, CmdLpushx, CmdLrange, CmdLrem, CmdLset, CmdLtrim, CmdMemoryDoctor, CmdMemoryHelp, CmdMemoryMallocStats, CmdMemoryPurge, CmdMemoryStats, CmdMemoryUsage, CmdMget, CmdMigrate, CmdModuleList, CmdModuleLoad, CmdModuleUnload, CmdMonitor, CmdMove, CmdMset, CmdMsetNx, CmdMulti, CmdObjectEncoding, CmdObjectFreq, CmdObjectHelp, CmdObjectIdletime, CmdObjectRefcount, CmdPTTL, CmdPersist, CmdPexpire, CmdPexpireat, CmdPfadd, CmdPfcount, CmdPfmerge, CmdPing, CmdPsubscribe, CmdPsync, CmdPublish, CmdPubsubChannels, CmdPubsubNumpat, CmdPubsubNumsub, CmdPunsubscribe, CmdQuit, CmdRandomkey, CmdReadonly, CmdReadwrite, CmdRename, CmdRenameNx, CmdReplicaof, CmdRestore, CmdRole, CmdRpop, CmdRpoplpush, CmdRpush, CmdRpushx, CmdSadd, CmdSave, CmdScan, CmdScard, CmdScriptDebug, CmdScriptExists, CmdScriptFlush, CmdScriptKill, CmdScriptLoad, CmdSdiff, CmdSdiffstore, CmdSelect, CmdSet, CmdSetEx, CmdSetExNx, CmdSetExXx, CmdSetNx, CmdSetPx, CmdSetPxNx, CmdSetPxXx, CmdSetXx, CmdSetbit, CmdSetrange, CmdShutdown, CmdSinter, CmdSinterstore, CmdSismember, CmdSlowlogGet, CmdSlowlogLen, CmdSlowlogReset, CmdSmembers, CmdSmove, CmdSort, CmdSpop, CmdSrandmember, CmdSrem, CmdSscan, CmdStralgoLcsIdxKeys, CmdStralgoLcsIdxStrings, CmdStralgoLcsKeys, CmdStralgoLcsLenKeys, CmdStralgoLcsLenStrings, CmdStralgoLcsStrings, CmdStrlen, CmdSubscribe, CmdSunion, CmdSunionstore, CmdSwapdb, CmdTTL, CmdTime, CmdTouch, CmdType, CmdUnlink, CmdUnsubscribe, CmdUnwatch, CmdWait, CmdWatch, CmdXack, CmdXadd, CmdXclaim, CmdXdel, CmdXgroupCreate, CmdXgroupDelconsumer, CmdXgroupDestroy, CmdXgroupHelp, CmdXgroupSetid, CmdXinfoConsumers, CmdXinfoGroups, CmdXinfoHelp, CmdXinfoStream, CmdXlen, CmdXpending, CmdXrange, CmdXread, CmdXreadgroup, CmdXrevrange, CmdXtrim, CmdZadd, CmdZaddCh, CmdZaddNx, CmdZaddXx, CmdZaddXxCh, CmdZcard, CmdZcount, CmdZincrby, CmdZinterstore, CmdZlexcount, CmdZpopmax, CmdZpopmin, CmdZrange, CmdZrangebylex, CmdZrangebyscore, CmdZrank, CmdZrem, CmdZremrangebylex, CmdZremrangebyrank, CmdZremrangebyscore, CmdZrevrange, CmdZrevrangebylex, CmdZrevrangebyscore, CmdZrevrank, CmdZscan, CmdZscore, CmdZunionstore}
+var CommandNames = []string{CmdAclCat, CmdAclDeluser, CmdAclGenpass, CmdAclGetuser, CmdAclHelp, CmdAclList, CmdAclLoad, CmdAclLogCount, CmdAclLogReset, CmdAclSave, CmdAclSetuser, CmdAclUsers, CmdAclWhoami, CmdAppend, CmdAuth, CmdBgrewriteaof, CmdBgsave, CmdBitcount, CmdBitfield, CmdBitopAnd, CmdBitopNot, CmdBitopOr, CmdBitopXor, CmdBitpos, CmdBlpop, CmdBrpop, CmdBrpoplpush, CmdBzpopmax, CmdBzpopmin, CmdClientCaching, CmdClientGetname, CmdClientGetredir, CmdClientId, CmdClientKill, CmdClientList, CmdClientPause, CmdClientReply, CmdClientSetname, CmdClientTracking, CmdClientUnblock, CmdClusterAddslots, CmdClusterBumpepoch, CmdClusterCountFailureReports, CmdClusterCountkeysinslot, CmdClusterDelslots, CmdClusterFailover, CmdClusterFlushslots, CmdClusterForget, CmdClusterGetkeysinslot, CmdClusterInfo, CmdClusterKeyslot, CmdClusterMeet, CmdClusterMyid, CmdClusterNodes, CmdClusterReplicas, CmdClusterReplicate, CmdClusterReset, CmdClusterSaveconfig, CmdClusterSetConfigEpoch, CmdClusterSetslotImporting, CmdClusterSetslotMigrating, CmdClusterSetslotNode, CmdClusterSetslotStable, CmdClusterSlots, CmdCommand, CmdCommandCount, CmdCommandGetkeys, CmdCommandInfo, CmdConfigGet, CmdConfigResetstat, CmdConfigRewrite, CmdConfigSet, CmdDbsize, CmdDebugObject, CmdDebugSegfault, CmdDecr, CmdDecrby, CmdDel, CmdDiscard, CmdDo, CmdDump, CmdEcho, CmdEval, CmdEvalsha, CmdExec, CmdExists, CmdExpire, CmdExpireat, CmdFlushall, CmdFlushdb, CmdGeoadd, CmdGeodist, CmdGeohash, CmdGeopos, CmdGeoradius, CmdGeoradiusbymember, CmdGet, CmdGetbit, CmdGetrange, CmdGetset, CmdHdel, CmdHello, CmdHexists, CmdHget, CmdHgetall, CmdHincrby, CmdHincrbyfloat, CmdHkeys, CmdHlen, CmdHmget, CmdHscan, CmdHset, CmdHsetNx, CmdHstrlen, CmdHvals, CmdIncr, CmdIncrby, CmdIncrbyfloat, CmdInfo, CmdKeys, CmdLastsave, CmdLatencyDoctor, CmdLatencyGraph, CmdLatencyHelp, CmdLatencyHistory, CmdLatencyLatest, CmdLatencyReset, CmdLindex, CmdLinsert, CmdLlen, CmdLolwut, CmdLpop, CmdLpos, CmdLpush, CmdLpushx, CmdLrange, CmdLrem, CmdLset, CmdLtrim, CmdMemoryDoctor, CmdMemoryHelp, CmdMemoryMallocStats, CmdMemoryPurge, CmdMemoryStats, CmdMemoryUsage, CmdMget, CmdMigrate, CmdModuleList, CmdModuleLoad, CmdModuleUnload, CmdMonitor, CmdMove, CmdMset, CmdMsetNx, CmdMulti, CmdObjectEncoding, CmdObjectFreq, CmdObjectHelp, CmdObjectIdletime, CmdObjectRefcount, CmdPTTL, CmdPersist, CmdPexpire, CmdPexpireat, CmdPfadd, CmdPfcount, CmdPfmerge, CmdPing, CmdPsubscribe, CmdPsync, CmdPublish, CmdPubsubChannels, CmdPubsubNumpat, CmdPubsubNumsub, CmdPubsubShardchannels, CmdPubsubShardnumsub, CmdPunsubscribe, CmdQuit, CmdRandomkey, CmdReadonly, CmdReadwrite, CmdRename, CmdRenameNx, CmdReplicaof, CmdRestore, CmdRole, CmdRpop, CmdRpoplpush, CmdRpush, CmdRpushx, CmdSadd, CmdSave, CmdScan, CmdScard, CmdScriptDebug, CmdScriptExists, CmdScriptFlush, CmdScriptKill, CmdScriptLoad, CmdSdiff, CmdSdiffstore, CmdSelect, CmdSet, CmdSetEx, CmdSetExNx, CmdSetExXx, CmdSetNx, CmdSetPx, CmdSetPxNx, CmdSetPxXx, CmdSetXx, CmdSetbit, CmdSetrange, CmdShutdown, CmdSinter, CmdSinterstore, CmdSismember, CmdSlowlogGet, CmdSlowlogLen, CmdSlowlogReset, CmdSmembers, CmdSmove, CmdSort, CmdSpop, CmdSpublish, CmdSrandmember, CmdSrem, CmdSscan, CmdSsubscribe, CmdStralgoLcsIdxKeys, CmdStralgoLcsIdxStrings, CmdStralgoLcsKeys, CmdStralgoLcsLenKeys, CmdStralgoLcsLenStrings, CmdStralgoLcsStrings, CmdStrlen, CmdSubscribe, CmdSunion, CmdSunionstore, CmdSunsubscribe, CmdSwapdb, CmdTTL, CmdTime, CmdTouch, CmdType, CmdUnlink, CmdUnsubscribe, CmdUnwatch, CmdWait, CmdWatch, CmdXack, CmdXadd, CmdXclaim, CmdXdel, CmdXgroupCreate, CmdXgroupDelconsumer, CmdXgroupDestroy, CmdXgroupHelp, CmdXgroupSetid, CmdXinfoConsumers, CmdXinfoGroups, CmdXinfoHelp, CmdXinfoStream, CmdXlen, CmdXpending, CmdXrange, CmdXread, CmdXreadgroup, CmdXrevrange, CmdXtrim, CmdZadd, CmdZaddCh, CmdZaddNx, CmdZaddXx, CmdZaddXxCh, CmdZcard, CmdZcount, CmdZincrby, CmdZinterstore, CmdZlexcount, CmdZpopmax, CmdZpopmin, CmdZrange, CmdZrangebylex, CmdZrangebyscore, CmdZrank, CmdZrem, CmdZremrangebylex, CmdZremrangebyrank, CmdZremrangebyscore, CmdZrevrange, CmdZrevrangebylex, CmdZrevrangebyscore, CmdZrevrank, CmdZscan, CmdZscore, CmdZunionstore}
+
+var ReadonlyCommands = map[string]bool{CmdBitcount: true, CmdBitpos: true, CmdDbsize: true, CmdDump: true, CmdExists: true, CmdGeodist: true, CmdGeohash: true, CmdGeopos: true, CmdGet: true, CmdGetbit: true, CmdGetrange: true, CmdHexists: true, CmdHget: true, CmdHgetall: true, CmdHkeys: true, CmdHlen: true, CmdHmget: true, CmdHscan: true, CmdHstrlen: true, CmdHvals: true, CmdKeys: true, CmdLindex: true, CmdLlen: true, CmdLolwut: true, CmdLpos: true, CmdLrange: true, CmdMemoryDoctor: true, CmdMemoryHelp: true, CmdMemoryMallocStats: true, CmdMemoryPurge: true, CmdMemoryStats: true, CmdMemoryUsage: true, CmdMget: true, CmdObjectEncoding: true, CmdObjectFreq: true, CmdObjectHelp: true, CmdObjectIdletime: true, CmdObjectRefcount: true, CmdPTTL: true, CmdPfcount: true, CmdRandomkey: true, CmdScan: true, CmdScard: true, CmdSdiff: true, CmdSinter: true, CmdSismember: true, CmdSmembers: true, CmdSrandmember: true, CmdSscan: true, CmdStralgoLcsIdxKeys: true, CmdStralgoLcsIdxStrings: true, CmdStralgoLcsKeys: true, CmdStralgoLcsLenKeys: true, CmdStralgoLcsLenStrings: true, CmdStralgoLcsStrings: true, CmdStrlen: true, CmdSunion: true, CmdTTL: true, CmdTouch: true, CmdType: true, CmdXinfoConsumers: true, CmdXinfoGroups: true, CmdXinfoHelp: true, CmdXinfoStream: true, CmdXlen: true, CmdXpending: true, CmdXrange: true, CmdXread: true, CmdXrevrange: true, CmdZcard: true, CmdZcount: true, CmdZlexcount: true, CmdZrange: true, CmdZrangebylex: true, CmdZrangebyscore: true, CmdZrank: true, CmdZrevrange: true, CmdZrevrangebylex: true, CmdZrevrangebyscore: true, CmdZrevrank: true, CmdZscan: true, CmdZscore: true}
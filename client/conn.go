@@ -19,6 +19,7 @@ package client
 import (
 	"context"
 	"errors"
+	"io"
 	"log"
 	"net"
 	"sync"
@@ -39,7 +40,14 @@ var ErrInShutdown = errors.New("connection is shutdown")
 // Conn represents the redis network connection.
 type Conn interface {
 	Commands
+	// WithContext returns the connection commands bound to ctx.
+	// Waiting for a command result is stopped when ctx is done.
+	WithContext(ctx context.Context) Commands
 	Pipeline() Pipeline
+	// TxPipeline returns a pipeline executing the queued commands as transaction.
+	TxPipeline() TxPipeline
+	// Tx executes the optimistic transaction fn watching keys (please see TxFunc).
+	Tx(ctx context.Context, keys []interface{}, fn TxFunc) error
 	Close() error
 	ConnInfo() ConnInfo
 	private() // private interface
@@ -47,7 +55,8 @@ type Conn interface {
 
 // ConnInfo provided information about a connection.
 type ConnInfo struct {
-	RedisVersion Version
+	RedisVersion Version // Redis version - not available for RESP2 connections
+	Protocol     int     // RESP protocol version
 }
 
 // ErrConnClosed is returned when calling methods on connection after the connection is closed.
@@ -65,40 +74,77 @@ func DialContext(ctx context.Context, address string) (Conn, error) {
 
 // check interface implementations.
 var (
-	_ Conn = (*conn)(nil)
+	_ Conn        = (*conn)(nil)
+	_ blobDecoder = (*decode)(nil)
 )
 
 type conn struct {
 	inShutdown int32 // atomic access
+	closing    int32 // atomic access
+	writers    int32 // number of pending results with reply writer (atomic access)
+	resp2      int32 // RESP2 connection (atomic access)
+	pubsub     int32 // RESP2 pubsub framing of a subscribed connection (atomic access)
 
 	mu      sync.RWMutex
-	flushMu sync.Mutex // protect flusch method
+	sendMu  sync.RWMutex // protect sendChan against close
+	flushMu sync.Mutex   // protect flusch method
 
 	db *db // connection owned by db - nil otherwise
 
-	netConn net.Conn
-	logger  *log.Logger
+	dialer  *Dialer
+	address string
+
+	netMu         sync.Mutex // protect netConn close and failErr
+	netConn       net.Conn
+	netConnClosed bool
+	failErr       error // protocol or write error the connection got closed by
+	logger        *log.Logger
+	closeErr      error
+	closeCh       chan struct{}
 
 	closed, pooled bool
 
+	createdAt, returnedAt, pingedAt time.Time // owned by db
+	gen                             uint64    // db address generation (owned by db)
+
 	*command
 
 	dec Decoder
-	enc Encoder
+	enc *encode
 
 	readChan chan interface{}
 	resChan  chan []*result
 	sendChan chan *result
 
-	hello Result
+	helloMu    sync.RWMutex
+	hello      Result
+	auth       *UsernamePassword
+	clientName *string
 
 	asyncTimeout       time.Duration
 	invalidateCallback InvalidateCallback
 	monitorCallback    MonitorCallback
+	pushCallback       PushCallback
+	traceCallback      TraceCallback
+
+	subscriptionCallback func(count int64) // called with the count of subscribe and unsubscribe notifications - nil otherwise
+	unsubscribing        [3]int32          // number of unsubscribe commands in flight per subscription kind (atomic access)
 
 	sendInterceptor SendInterceptor
 
-	nextResult func() *result
+	// pubsub subscriptions (owned by cmdHandler)
+	channelMap map[string]MsgCallback
+	patternMap map[string]MsgCallback
+	shardMap   map[string]MsgCallback
+
+	// connection state to be restored on reconnect (owned by cmdHandler) - nil if reconnect is disabled
+	session *session
+
+	// protocol error detected - replies are discarded until reset (owned by cmdHandler)
+	failed bool
+
+	nextResult    func() *result
+	pendingResult func() *result
 
 	shutdown <-chan bool
 }
@@ -108,10 +154,11 @@ const (
 	minimumChannelSize = 100
 )
 
-func newConn(db *db, netConn net.Conn, d *Dialer) (*conn, error) {
+func newConn(db *db, netConn net.Conn, d *Dialer, address string) (*conn, error) {
 	c := &conn{
 		db:                 db,
-		netConn:            netConn,
+		dialer:             d,
+		address:            address,
 		logger:             d.Logger,
 		readChan:           make(chan interface{}, d.channelSize()),
 		resChan:            make(chan []*result, defResultItems),
@@ -119,60 +166,229 @@ func newConn(db *db, netConn net.Conn, d *Dialer) (*conn, error) {
 		asyncTimeout:       d.AsyncTimeout,
 		invalidateCallback: d.InvalidateCallback,
 		monitorCallback:    d.MonitorCallback,
+		pushCallback:       d.PushCallback,
+		traceCallback:      d.TraceCallback,
 		sendInterceptor:    d.SendInterceptor,
+		channelMap:         map[string]MsgCallback{},
+		patternMap:         map[string]MsgCallback{},
+		shardMap:           map[string]MsgCallback{},
+		closeCh:            make(chan struct{}),
+
+		subscriptionCallback: d.subscriptionCallback,
 	}
 
-	if c.logger != nil {
-		c.logger.Printf("remote address %s - local address %s", c.netConn.RemoteAddr().String(), c.netConn.LocalAddr().String())
+	if d.Reconnect {
+		c.session = new(session)
 	}
 
-	c.command = newCommand(c.send, c.sendInterceptor)
+	c.setNetConn(netConn)
 
-	if d.TraceCallback != nil {
-		c.enc, c.dec = tracer(d.TraceCallback, netConn)
-	} else {
-		c.enc = NewEncoder(netConn)
-		c.dec = NewDecoder(netConn)
-	}
+	c.command = newCommand(c.send, c.sendInterceptor)
 
-	c.nextResult = c.resultIterator()
+	c.nextResult, c.pendingResult = c.resultIterator()
 
 	c.shutdown = c.watch()
 
-	var auth *UsernamePassword
 	if d.Username != "" || d.Password != "" {
-		auth = &UsernamePassword{Username: d.Username, Password: d.Password}
+		c.auth = &UsernamePassword{Username: d.Username, Password: d.Password}
 	}
-	var clientName *string
 	if d.ClientName != "" {
-		clientName = &d.ClientName
+		c.clientName = &d.ClientName
 	}
 
-	c.hello = c.Hello(protocolVersion, auth, clientName)
-	if err := c.hello.Err(); err != nil {
+	if err := c.handshake(); err != nil {
 		c.Close()
 		return nil, err
 	}
 	return c, nil
 }
 
+// handshake negotiates the protocol version, authenticates the connection, sets the client name
+// and selects the database.
+func (c *conn) handshake() error {
+	if err := c.negotiate(); err != nil {
+		return err
+	}
+	if c.dialer.DB != 0 {
+		return c.Select(int64(c.dialer.DB)).Err()
+	}
+	return nil
+}
+
+// negotiate negotiates the protocol version, authenticates the connection and sets the client name.
+func (c *conn) negotiate() error {
+	if c.dialer.Protocol != ProtocolRESP2 {
+		hello := c.helloCmd(c.command)
+		err := hello.Err()
+		if err == nil {
+			c.setHello(hello)
+			return nil
+		}
+		if _, ok := err.(*RedisError); !ok || c.dialer.Protocol != ProtocolFallback {
+			return err
+		}
+		c.logf("%s - falling back to RESP2", err)
+	}
+
+	atomic.StoreInt32(&c.resp2, 1)
+	for _, r := range c.resp2HelloCmds(c.command) {
+		if err := r.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) setNetConn(netConn net.Conn) {
+	c.netMu.Lock()
+	c.netConn = netConn
+	c.netConnClosed = false
+	c.failErr = nil
+	c.netMu.Unlock()
+	atomic.StoreInt32(&c.pubsub, 0)
+	for i := range c.unsubscribing { // unsubscribe commands in flight are failed
+		atomic.StoreInt32(&c.unsubscribing[i], 0)
+	}
+
+	if c.logger != nil {
+		c.logger.Printf("remote address %s - local address %s", c.netConn.RemoteAddr(), c.netConn.LocalAddr())
+	}
+
+	if c.traceCallback != nil {
+		c.enc, c.dec = tracer(c.traceCallback, netConn)
+	} else {
+		c.enc = newEncode(netConn)
+		c.dec = newDecode(netConn, c.dialer.ReplyArena)
+	}
+}
+
+// setShutdown sets the shutdown status - send does not write to sendChan afterwards.
+func (c *conn) setShutdown() {
+	c.sendMu.Lock()
+	atomic.StoreInt32(&c.inShutdown, 1)
+	c.sendMu.Unlock()
+}
+
+// closeNetConn closes the network connection once.
+func (c *conn) closeNetConn() error {
+	c.netMu.Lock()
+	defer c.netMu.Unlock()
+	if c.netConnClosed {
+		return nil
+	}
+	c.netConnClosed = true
+	return c.netConn.Close()
+}
+
+// fail closes the network connection because of the protocol or write error err.
+// The reader stops on the closed connection reporting err.
+func (c *conn) fail(err error) {
+	c.netMu.Lock()
+	if c.failErr == nil {
+		c.failErr = err
+	}
+	c.netMu.Unlock()
+	c.closeNetConn()
+}
+
+// failure returns the error the network connection got closed by - nil otherwise.
+func (c *conn) failure() error {
+	c.netMu.Lock()
+	defer c.netMu.Unlock()
+	return c.failErr
+}
+
+// failProtocol acknowledges result r (if not nil) with the protocol error err and closes the network connection.
+// All subsequent replies are discarded (handler only).
+func (c *conn) failProtocol(r *result, err *ProtocolError) {
+	if r != nil {
+		r.ack(nil, err)
+	}
+	c.failed = true
+	c.fail(err)
+}
+
+// isShutdown returns true if the connection is in shutdown and cannot be used anymore.
+func (c *conn) isShutdown() bool { return atomic.LoadInt32(&c.inShutdown) != 0 }
+
+// discard drops a value read after a protocol error (handler only).
+// Pending results are acknowledged by the watcher after the reader stopped.
+func (c *conn) discard(val interface{}) {
+	switch val := val.(type) {
+	case *writerQuery:
+		val.ch <- nil
+	case *arenaReply:
+		val.arena.release()
+	case *resetMarker:
+		c.handleReset(val)
+	}
+}
+
+// setClosing marks the connection as closing (no reconnect).
+func (c *conn) setClosing() {
+	if atomic.CompareAndSwapInt32(&c.closing, 0, 1) {
+		close(c.closeCh)
+	}
+}
+
+func (c *conn) helloCmd(cmd *command) Result {
+	return cmd.Hello(protocolVersion, c.auth, c.clientName)
+}
+
+// resp2HelloCmds sends the commands replacing HELLO for RESP2 connections.
+func (c *conn) resp2HelloCmds(cmd *command) []Result {
+	var results []Result
+	if c.auth != nil {
+		var username *string
+		if c.auth.Username != "" { // Redis versions before 6 do not support AUTH username
+			username = &c.auth.Username
+		}
+		results = append(results, cmd.Auth(username, c.auth.Password))
+	}
+	if c.clientName != nil {
+		results = append(results, cmd.ClientSetname(*c.clientName))
+	}
+	return results
+}
+
+// isRESP2 returns true if the connection uses RESP2.
+func (c *conn) isRESP2() bool { return atomic.LoadInt32(&c.resp2) != 0 }
+
+func (c *conn) setHello(hello Result) {
+	c.helloMu.Lock()
+	c.hello = hello
+	c.helloMu.Unlock()
+}
+
 func (c *conn) private() {} // private interface
 
-func (c *conn) resultIterator() func() *result {
+// resultIterator returns the functions to iterate through flushed results.
+// - next is waiting for the next result or returns nil if resChan is closed.
+// - pending returns the next result or nil if no result is available.
+func (c *conn) resultIterator() (next, pending func() *result) {
 	var (
 		results   []*result
 		size, pos int
 	)
 
-	return func() *result {
+	iterate := func(wait bool) *result {
 		if pos >= size {
 			if results != nil {
 				freeResults.put(results)
+				results = nil
 			}
-			pos = 0
+			pos, size = 0, 0
 			var ok bool
 			for {
-				results, ok = <-c.resChan
+				if wait {
+					results, ok = <-c.resChan
+				} else {
+					select {
+					case results, ok = <-c.resChan:
+					default:
+						return nil
+					}
+				}
 				if !ok {
 					return nil
 				}
@@ -186,9 +402,13 @@ func (c *conn) resultIterator() func() *result {
 		pos++
 		return results[i]
 	}
+
+	return func() *result { return iterate(true) }, func() *result { return iterate(false) }
 }
 
 func (c *conn) send(name string, r *result) {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
 	if atomic.LoadInt32(&c.inShutdown) != 0 {
 		r.setErr(ErrInShutdown)
 		return
@@ -202,10 +422,14 @@ const (
 )
 
 func (c *conn) ConnInfo() ConnInfo {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.helloMu.RLock()
+	defer c.helloMu.RUnlock()
+
+	if c.isRESP2() {
+		return ConnInfo{Protocol: protocolVersionRESP2}
+	}
 
-	ci := ConnInfo{}
+	ci := ConnInfo{Protocol: protocolVersion}
 
 	if m, err := c.hello.ToStringMap(); err == nil {
 		if s, ok := m[helpVersion].(string); ok {
@@ -223,7 +447,7 @@ func (c *conn) waitClosedLocked() error {
 	c.closed = true
 	select {
 	case <-c.shutdown: // wait for watcher to shutdown
-		return c.netConn.Close()
+		return c.closeErr
 		// TODO timeout
 	}
 }
@@ -240,14 +464,30 @@ func (c *conn) Close() error {
 		c.pooled = true
 		return nil
 	}
+	c.setClosing()
 	c.quitLocked()
 	return c.waitClosedLocked()
 }
 
+// unpool resets the pooled status of a connection taken from the db pool.
+func (c *conn) unpool() {
+	c.mu.Lock()
+	c.pooled = false
+	c.mu.Unlock()
+}
+
+func (c *conn) WithContext(ctx context.Context) Commands {
+	return newCommand(contextSend(ctx, c.send), c.sendInterceptor)
+}
+
 func (c *conn) Pipeline() Pipeline {
 	return newPipeline(c)
 }
 
+func (c *conn) TxPipeline() TxPipeline {
+	return newTxPipeline(c)
+}
+
 func (c *conn) watch() <-chan bool {
 
 	shutdown := make(chan bool)
@@ -270,11 +510,19 @@ func (c *conn) watch() <-chan bool {
 		err := <-errChan
 		wgReader.Wait() // wait for reader
 
-		atomic.StoreInt32(&c.inShutdown, 1)
+		if c.session != nil {
+			err = c.reconnect(err, &wgReader, errChan)
+		}
+
+		c.setShutdown()
 
 		close(c.readChan) // stop handler
 		wgHandler.Wait()  // wait for handler
 
+		if c.invalidateCallback != nil { // no invalidations anymore
+			c.invalidateCallback(nil)
+		}
+
 		close(c.sendChan) // stop sender
 		wgSender.Wait()   // wait for sender
 
@@ -288,6 +536,8 @@ func (c *conn) watch() <-chan bool {
 			r.ack(nil, err)
 		}
 
+		c.closeErr = c.closeNetConn()
+
 		close(shutdown)
 
 	}()
@@ -297,8 +547,6 @@ func (c *conn) watch() <-chan bool {
 }
 
 func (c *conn) cmdHandler(wg *sync.WaitGroup, readChan <-chan interface{}) {
-	channelMap := map[string]MsgCallback{}
-
 	defer wg.Done()
 
 	for {
@@ -308,28 +556,28 @@ func (c *conn) cmdHandler(wg *sync.WaitGroup, readChan <-chan interface{}) {
 			return
 		}
 
+		if c.failed {
+			c.discard(val)
+			continue
+		}
+
 		switch val := val.(type) {
 
-		case RedisValue:
-			result := c.nextResult()
-			result.ack(val, nil)
+		case RedisValue, error, *arenaReply:
+			c.ackResult(c.nextResult(), val)
 
-		case error:
-			result := c.nextResult()
-			result.ack(nil, val)
+		case *writerQuery:
+			c.handleWriterQuery(val, readChan)
 
 		case *subscribeNotification:
-			if ok := c.handleSubscribeNotification(val, channelMap, readChan); !ok {
-				return
-			}
+			c.handleSubscribeNotification(val, readChan)
 
 		case *unsubscribeNotification:
-			if ok := c.handleUnsubscribeNotification(val, channelMap, readChan); !ok {
-				return
-			}
+			c.handleUnsubscribeNotification(val, readChan)
 
 		case *publishNotification:
-			if cb, ok := channelMap[val.channel]; ok && cb != nil {
+			kind, name := val.subscription()
+			if cb, ok := c.subscriptionMap(kind)[name]; ok && cb != nil {
 				cb(val.pattern, val.channel, val.msg)
 			}
 
@@ -344,42 +592,157 @@ func (c *conn) cmdHandler(wg *sync.WaitGroup, readChan <-chan interface{}) {
 			}
 
 		case *genericNotification:
+			if c.pushCallback != nil {
+				c.pushCallback(val.kind, val.values)
+			}
+
+		case *resetMarker:
+			c.handleReset(val)
 
 		default:
-			panic("invalid messsage type")
+			c.failProtocol(nil, newProtocolError("invalid message type %T", val))
 		}
 	}
 }
 
-func (c *conn) handleSubscribeNotification(n *subscribeNotification, channelMap map[string]MsgCallback, readChan <-chan interface{}) bool {
+// ackResult acknowledges result r with the reply value or error val.
+func (c *conn) ackResult(r *result, val interface{}) {
+	if r.request.w != nil {
+		atomic.AddInt32(&c.writers, -1)
+	}
+
+	var arena *replyArena
+	if reply, ok := val.(*arenaReply); ok {
+		if r.request.onAck != nil || r.request.w != nil { // value might be kept (e.g. cache)
+			val = cloneValue(reply.value)
+			reply.arena.release()
+		} else {
+			val, arena = reply.value, reply.arena
+		}
+	}
+
+	switch val := val.(type) {
+	case RedisValue:
+		if c.isRESP2() {
+			val = resp2Value(r.request.cmd, val)
+		}
+		if c.session != nil {
+			c.updateSession(r.request.cmd)
+		}
+		if r.request.w != nil { // reply not written by reader
+			v, err := writeValue(r.request.w, val)
+			r.ack(v, err)
+			return
+		}
+		r.arena = arena
+		r.ack(val, nil)
+	case error:
+		r.ack(nil, val)
+	default:
+		c.failProtocol(r, newProtocolError("unexpected reply type %T", val))
+	}
+}
+
+// A writerQuery is sent by the reader before decoding a bulk string reply
+// in case results with reply writer are pending.
+type writerQuery struct {
+	ch chan io.Writer
+}
+
+// handleWriterQuery answers the reader query with the reply writer of the next result
+// and acknowledges the result with the reply following the query.
+func (c *conn) handleWriterQuery(q *writerQuery, readChan <-chan interface{}) {
+	result := c.nextResult()
+	q.ch <- result.request.w
+	val, ok := c.nextPush(result, readChan)
+	if !ok {
+		return
+	}
+	if v, ok := val.(*writtenReply); ok {
+		atomic.AddInt32(&c.writers, -1)
+		switch {
+		case v.err != nil:
+			result.ack(nil, v.err)
+		case v.n < 0: // RESP2 null bulk string
+			result.ack(_Null, nil)
+		default:
+			result.ack(_number(v.n), nil)
+		}
+		return
+	}
+	c.ackResult(result, val)
+}
+
+func (c *conn) subscriptionMap(kind subscriptionKind) map[string]MsgCallback {
+	switch kind {
+	case subscriptionPattern:
+		return c.patternMap
+	case subscriptionShard:
+		return c.shardMap
+	default:
+		return c.channelMap
+	}
+}
+
+// nextPush returns the next push notification or reply expected by result r.
+// In case the read channel is closed or the connection got lost, r is acknowledged with an error and ok is false.
+func (c *conn) nextPush(r *result, readChan <-chan interface{}) (interface{}, bool) {
+	val, ok := <-readChan
+	if !ok { // channel closed
+		r.ack(nil, ErrInShutdown)
+		return nil, false
+	}
+	if m, ok := val.(*resetMarker); ok { // connection lost
+		r.ack(nil, m.err)
+		c.handleReset(m)
+		return nil, false
+	}
+	return val, true
+}
+
+func (c *conn) handleSubscribeNotification(n *subscribeNotification, readChan <-chan interface{}) {
 	result := c.nextResult()
 
 	size := len(result.request.cmd)
 	channels := result.request.cmd[1:size]
+	subscriptionMap := c.subscriptionMap(n.kind)
 
 	for i, ch := range channels { // expect a push message for all subscribed channels
 
 		ch := ch.(string)
 
 		if i != 0 {
-			val, ok := <-readChan
-			if !ok { // channel closed
-				return false
+			val, ok := c.nextPush(result, readChan)
+			if !ok {
+				return
+			}
+			if n, ok = val.(*subscribeNotification); !ok {
+				c.failProtocol(result, newProtocolError("subscribe: unexpected message type %T", val))
+				return
 			}
-			n = val.(*subscribeNotification)
 		}
 
 		if n.channel != ch {
-			panic("subscribe: command message channel mismatch")
+			c.failProtocol(result, newProtocolError("subscribe: command message channel mismatch %s - %s", ch, n.channel))
+			return
 		}
-		channelMap[ch] = result.request.cb
+		subscriptionMap[ch] = result.request.cb
+		c.notifySubscriptions(n.count)
 	}
 
-	result.ack(nil, nil)
-	return true
+	result.ack(_number(n.count), nil)
 }
 
-func (c *conn) handleUnsubscribeNotification(n *unsubscribeNotification, channelMap map[string]MsgCallback, readChan <-chan interface{}) bool {
+func (c *conn) handleUnsubscribeNotification(n *unsubscribeNotification, readChan <-chan interface{}) {
+	subscriptionMap := c.subscriptionMap(n.kind)
+
+	if atomic.LoadInt32(&c.unsubscribing[n.kind]) == 0 { // unsubscribed by server (e.g. shard channel slot migrated)
+		delete(subscriptionMap, n.channel)
+		c.notifySubscriptions(n.count)
+		return
+	}
+	atomic.AddInt32(&c.unsubscribing[n.kind], -1)
+
 	result := c.nextResult()
 
 	size := len(result.request.cmd)
@@ -392,45 +755,79 @@ func (c *conn) handleUnsubscribeNotification(n *unsubscribeNotification, channel
 			ch := ch.(string)
 
 			if i != 0 {
-				val, ok := <-readChan
-				if !ok { // channel closed
-					return false
+				val, ok := c.nextPush(result, readChan)
+				if !ok {
+					return
+				}
+				if n, ok = val.(*unsubscribeNotification); !ok {
+					c.failProtocol(result, newProtocolError("unsubscribe: unexpected message type %T", val))
+					return
 				}
-				n = val.(*unsubscribeNotification)
 			}
 			if n.channel != ch {
-				panic("unsubscribe: command message channel mismatch")
+				c.failProtocol(result, newProtocolError("unsubscribe: command message channel mismatch %s - %s", ch, n.channel))
+				return
 			}
-			delete(channelMap, ch)
+			delete(subscriptionMap, ch)
+			c.notifySubscriptions(n.count)
 		}
 
-		result.ack(nil, nil)
-		return true
+		result.ack(_number(n.count), nil)
+		return
 	}
 
 	// unsubscribe from all channels
+	// count includes channel and pattern subscriptions - stop as soon as all subscriptions of this kind are removed
 	for {
-		delete(channelMap, n.channel)
-		if n.count == 0 {
+		delete(subscriptionMap, n.channel)
+		c.notifySubscriptions(n.count)
+		if n.count == 0 || len(subscriptionMap) == 0 {
 			break
 		}
-		val, ok := <-readChan
-		if !ok { // channel closed
-			return false
+		val, ok := c.nextPush(result, readChan)
+		if !ok {
+			return
 		}
-		n = val.(*unsubscribeNotification)
+		if n, ok = val.(*unsubscribeNotification); !ok {
+			c.failProtocol(result, newProtocolError("unsubscribe: unexpected message type %T", val))
+			return
+		}
+	}
+
+	result.ack(_number(n.count), nil)
+}
+
+// notifySubscriptions calls the subscription callback with the number of subscriptions.
+func (c *conn) notifySubscriptions(count int64) {
+	if c.subscriptionCallback != nil {
+		c.subscriptionCallback(count)
 	}
+}
 
-	result.ack(nil, nil)
-	return true
+// addUnsubscribing adds delta to the number of unsubscribe commands in flight.
+func (c *conn) addUnsubscribing(results []*result, delta int32) {
+	for _, r := range results {
+		if kind, ok := unsubscribeKind(r.request.cmd); ok {
+			atomic.AddInt32(&c.unsubscribing[kind], delta)
+		}
+	}
 }
 
 func (c *conn) reader(wg *sync.WaitGroup, readChan chan<- interface{}, errorChan chan<- error) {
 	defer wg.Done()
 
 	for {
-		val, err := c.dec.Decode()
+		val, err := c.decode(readChan)
+		if err == nil && atomic.LoadInt32(&c.pubsub) != 0 {
+			val, err = resp2Notification(val)
+		}
 		if err != nil {
+			if fErr := c.failure(); fErr != nil { // connection closed by handler or flush
+				err = fErr
+			}
+			if _, ok := err.(*ProtocolError); ok {
+				c.logf("%s - closing connection", err)
+			}
 			errorChan <- err
 			return
 		}
@@ -438,23 +835,119 @@ func (c *conn) reader(wg *sync.WaitGroup, readChan chan<- interface{}, errorChan
 	}
 }
 
+// A blobDecoder is a Decoder able to write bulk string replies to a writer.
+type blobDecoder interface {
+	peek() (byte, error)
+	decodeBlobTo(w io.Writer) (n int64, werr, err error)
+}
+
+// A writtenReply is the reply of a result written to the reply writer by the reader.
+type writtenReply struct {
+	n   int64 // number of bytes written - -1 for null
+	err error // write error
+}
+
+// decode decodes the next value.
+// In case results with reply writer are pending, bulk string replies are written
+// to the writer of the corresponding result instead of being materialized.
+func (c *conn) decode(readChan chan<- interface{}) (interface{}, error) {
+	if atomic.LoadInt32(&c.writers) == 0 {
+		return c.dec.Decode()
+	}
+	d, ok := c.dec.(blobDecoder)
+	if !ok {
+		return c.dec.Decode()
+	}
+	t, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t != blobStringType {
+		return c.dec.Decode()
+	}
+
+	q := &writerQuery{ch: make(chan io.Writer)}
+	readChan <- q
+	w := <-q.ch
+	if w == nil {
+		return c.dec.Decode()
+	}
+	n, werr, err := d.decodeBlobTo(w)
+	if err != nil {
+		return nil, err
+	}
+	return &writtenReply{n: n, err: werr}, nil
+}
+
 func (c *conn) flush(pipeline bool, results []*result) error {
 	c.flushMu.Lock()
 	defer c.flushMu.Unlock()
+	return c.flushLocked(pipeline, results)
+}
+
+func (c *conn) flushLocked(pipeline bool, results []*result) error {
+	if atomic.LoadInt32(&c.inShutdown) != 0 { // do not write to connection in shutdown
+		for _, r := range results {
+			if pipeline {
+				r.flush()
+			}
+			r.ack(nil, ErrInShutdown)
+		}
+		freeResults.put(results)
+		return ErrInShutdown
+	}
+	written := results[:0]
 	for _, r := range results {
 		if pipeline {
 			r.flush()
 		}
+		if err := c.enc.Encode(r.cmd()); err != nil && c.enc.err == nil { // invalid argument - command not written
+			r.ack(nil, err)
+			continue
+		}
 		r.setTimeout(c.asyncTimeout)
-		c.enc.Encode(r.cmd())
+		if r.request.w != nil {
+			atomic.AddInt32(&c.writers, 1)
+		}
+		written = append(written, r) // write errors are returned by Flush
+	}
+	results = written
+	if len(results) == 0 {
+		freeResults.put(results)
+		return nil
 	}
+	if c.isRESP2() { // before the reply might be read
+		c.setPubsub(results)
+	}
+	c.addUnsubscribing(results, 1) // before the reply might be read
 	if err := c.enc.Flush(); err != nil {
-		panic(err) // TODO
+		c.failWriteLocked(results, err)
+		return err
 	}
 	c.resChan <- results
 	return nil
 }
 
+// failWriteLocked acknowledges the results of a failed write with err and closes the network connection.
+// Results written before are acknowledged by the watcher after the reader stopped.
+// Without reconnect the connection is shut down, so that subsequent commands fail immediately
+// and a pooled connection gets discarded.
+func (c *conn) failWriteLocked(results []*result, err error) {
+	c.addUnsubscribing(results, -1)
+	for _, r := range results {
+		if r.request.w != nil {
+			atomic.AddInt32(&c.writers, -1)
+		}
+		r.ack(nil, err)
+	}
+	freeResults.put(results)
+	if c.session == nil {
+		atomic.StoreInt32(&c.inShutdown, 1)
+	}
+	c.logf("write error: %s - closing connection", err)
+	c.fail(err)
+}
+
 func (c *conn) sender(wg *sync.WaitGroup, sendChan <-chan *result) {
 	defer wg.Done()
 
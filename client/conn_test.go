@@ -0,0 +1,144 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errFaultyConn = errors.New("faulty connection")
+
+// A faultyConn is a network connection failing all writes after fail got called.
+type faultyConn struct {
+	net.Conn
+	failing int32
+}
+
+func newFaultyConn(t *testing.T, address string) *faultyConn {
+	c, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &faultyConn{Conn: c}
+}
+
+func (c *faultyConn) fail() { atomic.StoreInt32(&c.failing, 1) }
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&c.failing) != 0 {
+		return 0, errFaultyConn
+	}
+	return c.Conn.Write(b)
+}
+
+func TestFlushWriteError(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	fc := newFaultyConn(t, s.addr())
+	conn, err := newConn(nil, fc, &Dialer{}, s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.Set("key", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	fc.fail()
+
+	p := conn.Pipeline()
+	r1 := p.Set("key", "value")
+	r2 := p.Get("key")
+	if err := p.Flush(); err != errFaultyConn {
+		t.Fatalf("got: %v expected: %v", err, errFaultyConn)
+	}
+	for _, r := range []Result{r1, r2} {
+		if err := r.Err(); err != errFaultyConn {
+			t.Fatalf("got: %v expected: %v", err, errFaultyConn)
+		}
+	}
+
+	if err := conn.Get("key").Err(); err != ErrInShutdown {
+		t.Fatalf("got: %v expected: %v", err, ErrInShutdown)
+	}
+	conn.Close()
+}
+
+func TestFlushWriteErrorReconnect(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	fc := newFaultyConn(t, s.addr())
+	conn, err := newConn(nil, fc, &Dialer{Reconnect: true, ReconnectBackoff: testBackoff(10 * time.Millisecond)}, s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fc.fail()
+
+	if err := conn.Set("key", "value").Err(); err != errFaultyConn {
+		t.Fatalf("got: %v expected: %v", err, errFaultyConn)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := conn.Set("key", "value").Err(); err != nil { // reconnected
+		t.Fatal(err)
+	}
+}
+
+func TestFlushEncodeError(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	conn, err := Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var typeErr *InvalidTypeError
+	if err := conn.Set("key", struct{ A int }{1}).Err(); !errors.As(err, &typeErr) {
+		t.Fatalf("got: %v expected: %T", err, typeErr)
+	}
+	// connection is not affected
+	if err := conn.Set("key", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the command with the invalid argument fails
+	p := conn.Pipeline()
+	r1 := p.Set("key", "value")
+	r2 := p.Set("key", struct{ A int }{1})
+	r3 := p.Get("key")
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.Err(); !errors.As(err, &typeErr) {
+		t.Fatalf("got: %v expected: %T", err, typeErr)
+	}
+	if v, err := r3.ToString(); err != nil || v != "value" {
+		t.Fatalf("got: %s expected: %s", v, "value")
+	}
+}
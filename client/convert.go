@@ -21,18 +21,23 @@ import (
 )
 
 // A ConversionError is raised for an unsuccessful type conversion of a redis value.
-// - To:    Name of the conversion function.
+// - To:    Name of the conversion function or the destination type (Scan).
 // - Value: Value for which the conversion was not successful.
+// - Path:  Path of the destination field (Scan) - empty otherwise.
 type ConversionError struct {
 	To    string
 	Value interface{}
+	Path  string
 }
 
 func newConversionError(to string, value interface{}) *ConversionError {
-	return &ConversionError{to, value}
+	return &ConversionError{To: to, Value: value}
 }
 
 func (e *ConversionError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("unsupported %s conversion type %T at %s", e.To, e.Value, e.Path)
+	}
 	return fmt.Sprintf("unsupported %s conversion type %T", e.To, e.Value)
 }
 
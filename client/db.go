@@ -28,28 +28,108 @@ import (
 const (
 	defaultMaxIdleConns  = 2
 	closeConnChannelSize = 10
+	minCleanerInterval   = time.Second
 )
 
+// DefaultAcquireTimeout is the default maximum amount of time a database command waits for a pooled connection.
+const DefaultAcquireTimeout = 5 * time.Second
+
 // ErrDBClosed is returned when calling methods on database after the database is closed.
 var ErrDBClosed = errors.New(ClientName + ": database is already closed")
 
+// ErrPoolExhausted is returned when acquiring a connection while the maximum number of waiters is reached (please see DBOptions).
+var ErrPoolExhausted = errors.New(ClientName + ": connection pool exhausted")
+
+// PoolOrder defines the order in which idle connections are reused.
+type PoolOrder int
+
+// Pool orders.
+const (
+	// PoolFIFO reuses the connection being idle for the longest time, so that the load is spread evenly.
+	PoolFIFO PoolOrder = iota
+	// PoolLIFO reuses the most recently returned connection, so that surplus connections
+	// stay idle and can be closed by the idle time limit (please see SetConnMaxIdleTime).
+	PoolLIFO
+)
+
+// DBOptions are the connection pool options of a database.
+type DBOptions struct {
+	// Maximum amount of time a command waits for a pooled connection. Zero means DefaultAcquireTimeout,
+	// a negative value means the command waits until the command context is done.
+	AcquireTimeout time.Duration
+	// Minimum number of idle connections. The connections are opened in background when the
+	// database is opened and replenished whenever the number of idle connections drops below
+	// the minimum. These connections are not closed due to their idle time.
+	MinIdleConns int
+	// Order in which idle connections are reused.
+	Order PoolOrder
+	// Maximum number of callers waiting for a connection in case the maximum number of open
+	// connections is reached (please see SetMaxOpenConns). Exceeding callers fail immediately
+	// with ErrPoolExhausted. Zero means unlimited.
+	MaxWaiters int
+	// Interval of keepalive pings. Idle connections not used or pinged within the interval
+	// are checked by a PING command in background. Connections not answering within the
+	// interval are closed and replaced (please see MinIdleConns). Zero disables keepalive pings.
+	KeepAliveInterval time.Duration
+	// Number of shared connections multiplexing the database commands. As connections are
+	// asynchronous, commands are pipelined and do not need to wait for a pooled connection.
+	// Blocking commands (e.g. BLPOP, XREAD with BLOCK option) are executed on dedicated pooled connections.
+	// Connection state changing commands (e.g. SUBSCRIBE, MONITOR, MULTI, WATCH, SELECT) fail with ErrConnStateCommand.
+	// Shared connections are not limited by the maximum number of open connections (please see SetMaxOpenConns).
+	// Zero disables multiplexing.
+	MultiplexConns int
+	// Distribution of the commands over the shared connections.
+	Balance BalancePolicy
+}
+
+// DBStats are the database connection pool statistics.
+type DBStats struct {
+	sql.DBStats
+	UnhealthyClosed   int64 // Total number of connections closed because they were broken or failed a keepalive ping.
+	SharedConnections int   // The number of open shared connections of a multiplexed database.
+}
+
 // DB is a database holding a pool of redis connections.
+// Connection state changing commands (e.g. SELECT, WATCH, MULTI) must not be executed on the database,
+// as the connection is put back to the pool in the changed state. Please use a connection (Conn)
+// or an optimistic transaction (Tx) instead.
 // *** not yet completely implemented - experimental ***
 type DB interface {
 	Commands
+	// WithContext returns the database commands bound to ctx.
+	// Acquiring a connection and waiting for a command result is stopped when ctx is done.
+	WithContext(ctx context.Context) Commands
 	Conn(ctx context.Context) (Conn, error)
+	// Tx executes the optimistic transaction fn watching keys on a pooled connection (please see TxFunc).
+	Tx(ctx context.Context, keys []interface{}, fn TxFunc) error
 	// Pipeline() Pipeline
 	Close() error
+	SetConnMaxIdleTime(d time.Duration)
 	SetConnMaxLifetime(d time.Duration)
 	SetMaxIdleConns(n int)
 	SetMaxOpenConns(n int)
-	Stats() sql.DBStats
+	Stats() DBStats
 	private() // private interface
 }
 
 // OpenDB open a new database.
+// The address is a host:port address or an URL (please see ParseURL).
+// Connection pool limits provided by the URL or a Dialer returned by ParseURL are applied to the database.
 func OpenDB(address string, dialer Dialer) DB {
-	return newDB(address, dialer)
+	return OpenDBWithOptions(address, dialer, DBOptions{})
+}
+
+// OpenDBWithOptions opens a new database with connection pool options (please see OpenDB).
+func OpenDBWithOptions(address string, dialer Dialer, opts DBOptions) DB {
+	db := newDB(address, dialer)
+	if dialer.pool != nil {
+		dialer.pool.apply(db)
+	}
+	if a, err := parseAddress(address); err == nil && a.pool != nil { // invalid addresses fail on dial
+		a.pool.apply(db)
+	}
+	db.setOptions(opts)
+	return db
 }
 
 // check interface implementations.
@@ -62,25 +142,50 @@ type db struct {
 	// atomic access (64-bit alignment on 32 platforms - please see https://golang.org/pkg/sync/atomic)
 	waitDuration int64 // Wait duration.
 
-	address string
-	dialer  Dialer
-	closed  int32
+	address     string
+	resolveAddr func(ctx context.Context) (string, error) // resolves address dynamically - nil otherwise
+	gen         uint64                                    // address generation - incremented on redirect
+	onClose     func()                                    // called on db close - nil otherwise
+	onConnect   func(c *conn) error                       // called on new connections - nil otherwise
+	dialer      Dialer
+	closed      int32
+
+	// connection pool options
+	acquireTimeout time.Duration // <= 0 means no timeout
+	minIdle        int
+	lifo           bool
+	maxWaiters     int // <= 0 means unlimited
+	keepAlive      time.Duration
+	shared         []*sharedConn // shared connection slots - nil if not multiplexed
+	balance        BalancePolicy
+	next           uint32 // next round robin slot (atomic access)
 
 	// connection pooling attributes
 	mu          sync.RWMutex
 	freeConn    []*conn
 	waitConn    map[chan *conn]struct{}
 	closeConnCh chan []*conn
+	cleanerCh   chan struct{}   // nil if connection cleaner is not running
+	fillerCh    chan struct{}   // nil if connection filler is not running
+	keepAliveCh chan struct{}   // nil if keepalive pings are not running
+	ctx         context.Context // background dials and pings - cancelled on close
+	cancel      context.CancelFunc
 	wg          sync.WaitGroup
+	cleanerWg   sync.WaitGroup
+	fillerWg    sync.WaitGroup
+	keepAliveWg sync.WaitGroup
 
 	// stats (please see https://golang.org/pkg/database/sql for reference)
-	numOpen int // number of opened and pending open connections
-	maxIdle int // zero means defaultMaxIdleConns; negative means 0
-	maxOpen int // <= 0 means unlimited
-	//maxLifetime       time.Duration // maximum amount of time a connection may be reused
-	waitCount         int64 // Total number of connections waited for.
-	maxIdleClosed     int64 // Total number of connections closed due to idle.
-	maxLifetimeClosed int64 // Total number of connections closed due to max free limit.
+	numOpen           int           // number of opened and pending open connections
+	maxIdle           int           // zero means defaultMaxIdleConns; negative means 0
+	maxOpen           int           // <= 0 means unlimited
+	maxLifetime       time.Duration // maximum amount of time a connection may be reused
+	maxIdleTime       time.Duration // maximum amount of time a connection may be idle before being closed
+	waitCount         int64         // Total number of connections waited for.
+	maxIdleClosed     int64         // Total number of connections closed due to idle.
+	maxIdleTimeClosed int64         // Total number of connections closed due to idle time.
+	maxLifetimeClosed int64         // Total number of connections closed due to max connection lifetime.
+	unhealthyClosed   int64         // Total number of connections closed because they were broken or failed a keepalive ping.
 
 	*command
 }
@@ -93,7 +198,10 @@ func newDB(address string, dialer Dialer) *db {
 		waitConn:    make(map[chan *conn]struct{}),
 		closeConnCh: make(chan []*conn, closeConnChannelSize),
 		maxIdle:     defaultMaxIdleConns,
+
+		acquireTimeout: DefaultAcquireTimeout,
 	}
+	db.ctx, db.cancel = context.WithCancel(context.Background())
 	db.command = newCommand(db.send, nil)
 
 	db.wg.Add(1)
@@ -110,7 +218,55 @@ func (db *db) Close() error { return db.close() }
 
 func (db *db) Conn(ctx context.Context) (Conn, error) { return db.getConn(ctx) }
 
-func (db *db) SetConnMaxLifetime(d time.Duration) { panic("not implemented") }
+func (db *db) Tx(ctx context.Context, keys []interface{}, fn TxFunc) error {
+	conn, err := db.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.releaseConn(conn)
+	return conn.Tx(ctx, keys, fn)
+}
+
+// WithContext returns the database commands bound to ctx.
+func (db *db) WithContext(ctx context.Context) Commands {
+	return newCommand(contextSend(ctx, db.send), nil)
+}
+
+// SetConnMaxIdleTime sets the maximum amount of time a connection may be idle.
+// Expired connections may be closed lazily before reuse.
+// If d <= 0, connections are not closed due to a connection's idle time.
+func (db *db) SetConnMaxIdleTime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// wake cleaner up when idle time is shortened.
+	if d > 0 && d < db.maxIdleTime {
+		db.wakeCleanerLocked()
+	}
+	db.maxIdleTime = d
+	db.startCleanerLocked()
+}
+
+// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
+// Expired connections may be closed lazily before reuse.
+// If d <= 0, connections are not closed due to a connection's age.
+func (db *db) SetConnMaxLifetime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// wake cleaner up when lifetime is shortened.
+	if d > 0 && d < db.maxLifetime {
+		db.wakeCleanerLocked()
+	}
+	db.maxLifetime = d
+	db.startCleanerLocked()
+}
 
 func (db *db) SetMaxIdleConns(n int) {
 	if n < 0 {
@@ -133,7 +289,7 @@ func (db *db) SetMaxIdleConns(n int) {
 	db.maxIdleClosed += int64(len(closeConn))
 	db.mu.Unlock()
 
-	db.closeConnCh <- closeConn
+	db.closeConns(closeConn)
 }
 
 func (db *db) SetMaxOpenConns(n int) {
@@ -149,64 +305,128 @@ func (db *db) SetMaxOpenConns(n int) {
 	}
 }
 
-func (db *db) Stats() sql.DBStats { return db.dbStats() }
+func (db *db) Stats() DBStats { return db.dbStats() }
 
 func (db *db) send(name string, r *result) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // TODO timeout configuration
+	switch {
+	case db.shared == nil:
+		db.withConn(r, func(conn *conn) { conn.send(name, r) })
+	case isConnState(name, r.request.cmd):
+		r.setErr(ErrConnStateCommand)
+	case isDedicated(name, r.request.cmd):
+		db.sendDedicated(name, r)
+	default:
+		db.sendShared(name, r)
+	}
+}
+
+// acquireContext returns the context for acquiring a connection for result r.
+func (db *db) acquireContext(r *result) (context.Context, context.CancelFunc) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if db.acquireTimeout > 0 {
+		return context.WithTimeout(ctx, db.acquireTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// acquireConn returns a pooled connection for result r. In case no connection is available r gets the error set.
+func (db *db) acquireConn(r *result) *conn {
+	ctx, cancel := db.acquireContext(r)
 	defer cancel()
 
 	conn, err := db.getConn(ctx)
 	if err != nil {
 		r.setErr(err)
+		return nil
+	}
+	return conn
+}
+
+// withConn calls fn with a pooled connection. In case no connection is available r gets the error set.
+func (db *db) withConn(r *result, fn func(conn *conn)) {
+	conn := db.acquireConn(r)
+	if conn == nil {
 		return
 	}
-	defer db.putConn(conn)
-	conn.send(name, r)
+	defer db.releaseConn(conn)
+	fn(conn)
 }
 
-func (db *db) dbStats() sql.DBStats {
+func (db *db) dbStats() DBStats {
 	wait := atomic.LoadInt64(&db.waitDuration)
+	numShared := db.numShared() // before db.mu (please see sharedConn)
 
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 	numFree := len(db.freeConn)
-	return sql.DBStats{
-		MaxOpenConnections: db.maxOpen,
-
-		Idle:            numFree,
-		OpenConnections: db.numOpen,
-		InUse:           db.numOpen - numFree,
-
-		WaitCount:         db.waitCount,
-		WaitDuration:      time.Duration(wait),
-		MaxIdleClosed:     db.maxIdleClosed,
-		MaxLifetimeClosed: db.maxLifetimeClosed,
+	return DBStats{
+		DBStats: sql.DBStats{
+			MaxOpenConnections: db.maxOpen,
+
+			Idle:            numFree,
+			OpenConnections: db.numOpen,
+			InUse:           db.numOpen - numFree,
+
+			WaitCount:         db.waitCount,
+			WaitDuration:      time.Duration(wait),
+			MaxIdleClosed:     db.maxIdleClosed,
+			MaxIdleTimeClosed: db.maxIdleTimeClosed,
+			MaxLifetimeClosed: db.maxLifetimeClosed,
+		},
+		UnhealthyClosed:   db.unhealthyClosed,
+		SharedConnections: numShared,
 	}
 }
 
 func (db *db) getConn(ctx context.Context) (*conn, error) {
+	if atomic.LoadInt32(&db.closed) != 0 {
+		return nil, ErrDBClosed
+	}
+
 	db.mu.Lock()
+
+	if expired := db.expiredConnsLocked(time.Now()); len(expired) > 0 {
+		defer db.closeConns(expired)
+	}
+
 	numFree := len(db.freeConn)
 
 	switch {
 
-	case (db.maxOpen <= 0 || db.numOpen <= db.maxOpen) && numFree > 0:
-		conn := db.freeConn[0]
-		copy(db.freeConn, db.freeConn[1:]) //fifo
+	case numFree > 0:
+		var conn *conn
+		if db.lifo {
+			conn = db.freeConn[numFree-1]
+		} else {
+			conn = db.freeConn[0]
+			copy(db.freeConn, db.freeConn[1:])
+		}
+		db.freeConn[numFree-1] = nil // release reference
 		db.freeConn = db.freeConn[:numFree-1]
+		db.wakeFillerLocked()
 		db.mu.Unlock()
+		conn.unpool()
 		return conn, nil
 
-	case db.numOpen <= 0 || db.numOpen <= db.maxOpen:
-		conn, err := db.dialer.dialContext(ctx, db.address)
+	case db.maxOpen <= 0 || db.numOpen < db.maxOpen:
+		db.numOpen++ // reserve connection and dial outside the lock
+		db.mu.Unlock()
+		conn, err := db.dialConn(ctx)
 		if err != nil {
+			db.mu.Lock()
+			db.discardConnLocked()
 			db.mu.Unlock()
 			return nil, err
 		}
-		db.numOpen++
-		db.mu.Unlock()
 		return conn, nil
 
+	case db.maxWaiters > 0 && len(db.waitConn) >= db.maxWaiters:
+		db.mu.Unlock()
+		return nil, ErrPoolExhausted
+
 	}
 
 	// wait for connection
@@ -228,18 +448,81 @@ func (db *db) getConn(ctx context.Context) (*conn, error) {
 
 		select {
 		default:
-		case conn := <-r: // check if connection was already provided
-			db.putConn(conn)
+		case conn := <-r: // check if connection or slot was already provided
+			if conn == nil { // hand slot over to next waiter
+				db.mu.Lock()
+				db.releaseSlotLocked()
+				db.mu.Unlock()
+				break
+			}
+			conn.unpool()
+			db.releaseConn(conn)
 		}
-		db.mu.Unlock()
 
 		return nil, ctx.Err()
 	case conn := <-r: // connection
 		atomic.AddInt64(&db.waitDuration, int64(time.Since(waitStart)))
+		if conn == nil { // connection discarded - slot available for a new connection
+			return db.getConn(ctx)
+		}
+		conn.unpool()
 		return conn, nil
 	}
 }
 
+// dialConn opens a new connection. The caller needs to account the connection in numOpen.
+func (db *db) dialConn(ctx context.Context) (*conn, error) {
+	db.mu.RLock()
+	address, gen := db.address, db.gen
+	db.mu.RUnlock()
+
+	if db.resolveAddr != nil {
+		var err error
+		if address, err = db.resolveAddr(ctx); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := db.dialer.dialContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if db.onConnect != nil {
+		if err := db.onConnect(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	conn.db = db
+	conn.gen = gen // redirected while dialing - connection is closed when put back to the pool
+	conn.createdAt = time.Now()
+	return conn, nil
+}
+
+// redirect sets a new address and closes all connections to the former address.
+// Connections in use are closed when put back to the pool.
+func (db *db) redirect(address string) {
+	db.mu.Lock()
+	db.address = address
+	db.gen++
+	freeConn := db.freeConn
+	db.freeConn = make([]*conn, 0)
+	db.numOpen -= len(freeConn)
+	db.wakeFillerLocked()
+	db.mu.Unlock()
+
+	freeConn = append(freeConn, db.removeSharedConns()...) // reconnected on next use
+	if len(freeConn) > 0 {
+		db.closeConns(freeConn)
+	}
+}
+
+// releaseConn puts the connection back to the pool or closes it.
+func (db *db) releaseConn(c *conn) {
+	if !db.putConn(c) {
+		db.closeConns([]*conn{c})
+	}
+}
+
 func (db *db) putConn(c *conn) bool {
 	if c == nil {
 		panic("putConn: connection is nil") // should never happen
@@ -247,6 +530,31 @@ func (db *db) putConn(c *conn) bool {
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	defer db.wakeFillerLocked() // replace discarded connection
+
+	if atomic.LoadInt32(&db.closed) != 0 {
+		db.discardConnLocked()
+		return false
+	}
+
+	if c.gen != db.gen { // redirected
+		db.discardConnLocked()
+		return false
+	}
+
+	if c.isShutdown() { // broken connection
+		db.unhealthyClosed++
+		db.discardConnLocked()
+		return false
+	}
+
+	now := time.Now()
+
+	if db.maxLifetime > 0 && now.Sub(c.createdAt) >= db.maxLifetime {
+		db.maxLifetimeClosed++
+		db.discardConnLocked()
+		return false
+	}
 
 	// check if somebody is waiting for a connection
 	for r := range db.waitConn {
@@ -255,45 +563,389 @@ func (db *db) putConn(c *conn) bool {
 		return true
 	}
 
-	if db.maxOpen > 0 && db.numOpen >= db.maxOpen {
-		db.numOpen--
+	if db.maxOpen > 0 && db.numOpen > db.maxOpen { // max open connections got lowered
+		db.discardConnLocked()
 		return false
 	}
 	if len(db.freeConn) >= db.maxIdle {
-		db.numOpen--
+		db.discardConnLocked()
 		return false
 	}
+	c.returnedAt = now
 	db.freeConn = append(db.freeConn, c)
 	return true
 }
 
+// discardConnLocked releases the slot of a connection which is not put back to the pool
+// or could not be opened.
+func (db *db) discardConnLocked() {
+	db.numOpen--
+	db.releaseSlotLocked()
+}
+
+// releaseSlotLocked signals a caller waiting for a connection to open a new connection
+// in case the maximum number of open connections is not reached.
+func (db *db) releaseSlotLocked() {
+	if db.maxOpen > 0 && db.numOpen >= db.maxOpen {
+		return
+	}
+	for r := range db.waitConn {
+		delete(db.waitConn, r)
+		r <- nil
+		return
+	}
+}
+
+// expiredConnsLocked removes the connections exceeding the maximum lifetime or idle time
+// and the connections in shutdown (e.g. after a network error) from the free list.
+func (db *db) expiredConnsLocked(now time.Time) []*conn {
+	var expired []*conn
+
+	numIdleExpirable := len(db.freeConn) - db.minIdle // keep the minimum number of idle connections
+
+	freeConn := db.freeConn[:0]
+	for _, c := range db.freeConn {
+		switch {
+		case c.isShutdown(): // broken connection
+			db.unhealthyClosed++
+			expired = append(expired, c)
+		case db.maxLifetime > 0 && now.Sub(c.createdAt) >= db.maxLifetime:
+			db.maxLifetimeClosed++
+			expired = append(expired, c)
+		case db.maxIdleTime > 0 && numIdleExpirable > 0 && now.Sub(c.returnedAt) >= db.maxIdleTime:
+			db.maxIdleTimeClosed++
+			numIdleExpirable--
+			expired = append(expired, c)
+		default:
+			freeConn = append(freeConn, c)
+		}
+	}
+	for i := len(freeConn); i < len(db.freeConn); i++ {
+		db.freeConn[i] = nil // release references
+	}
+	db.freeConn = freeConn
+	db.numOpen -= len(expired)
+	if len(expired) > 0 {
+		db.wakeFillerLocked()
+	}
+	return expired
+}
+
+// cleanerIntervalLocked returns the interval of the connection cleaner - zero if no cleaner is needed.
+func (db *db) cleanerIntervalLocked() time.Duration {
+	d := db.maxLifetime
+	if db.maxIdleTime > 0 && (d <= 0 || db.maxIdleTime < d) {
+		d = db.maxIdleTime
+	}
+	if d > 0 && d < minCleanerInterval {
+		d = minCleanerInterval
+	}
+	return d
+}
+
+func (db *db) startCleanerLocked() {
+	if db.cleanerCh != nil || atomic.LoadInt32(&db.closed) != 0 {
+		return
+	}
+	if d := db.cleanerIntervalLocked(); d > 0 {
+		db.cleanerCh = make(chan struct{}, 1)
+		db.cleanerWg.Add(1)
+		go db.connCleaner(&db.cleanerWg, db.cleanerCh, d)
+	}
+}
+
+func (db *db) wakeCleanerLocked() {
+	if db.cleanerCh == nil {
+		return
+	}
+	select {
+	case db.cleanerCh <- struct{}{}:
+	default:
+	}
+}
+
+// setOptions sets the connection pool options and starts the connection filler if needed.
+func (db *db) setOptions(opts DBOptions) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch {
+	case opts.AcquireTimeout > 0:
+		db.acquireTimeout = opts.AcquireTimeout
+	case opts.AcquireTimeout < 0:
+		db.acquireTimeout = 0
+	}
+	db.lifo = opts.Order == PoolLIFO
+	db.maxWaiters = opts.MaxWaiters
+	if opts.MinIdleConns > 0 {
+		db.minIdle = opts.MinIdleConns
+		if db.maxIdle < db.minIdle {
+			db.maxIdle = db.minIdle
+			if db.maxOpen > 0 && db.maxIdle > db.maxOpen {
+				db.maxIdle = db.maxOpen
+			}
+		}
+		db.startFillerLocked()
+	}
+	if opts.MultiplexConns > 0 {
+		db.shared = make([]*sharedConn, opts.MultiplexConns)
+		for i := range db.shared {
+			db.shared[i] = new(sharedConn)
+		}
+		db.balance = opts.Balance
+	}
+	if opts.KeepAliveInterval > 0 {
+		db.keepAlive = opts.KeepAliveInterval
+		db.keepAliveCh = make(chan struct{})
+		db.keepAliveWg.Add(1)
+		go db.connKeepAlive(&db.keepAliveWg, db.keepAliveCh, db.keepAlive)
+	}
+}
+
+func (db *db) startFillerLocked() {
+	if db.fillerCh != nil || atomic.LoadInt32(&db.closed) != 0 {
+		return
+	}
+	db.fillerCh = make(chan struct{}, 1)
+	db.fillerWg.Add(1)
+	go db.connFiller(&db.fillerWg, db.fillerCh)
+	db.wakeFillerLocked() // warm up
+}
+
+// wakeFillerLocked wakes the connection filler up in case the number of idle connections
+// dropped below the minimum.
+func (db *db) wakeFillerLocked() {
+	if db.fillerCh == nil || len(db.freeConn) >= db.minIdle {
+		return
+	}
+	select {
+	case db.fillerCh <- struct{}{}:
+	default:
+	}
+}
+
 func (db *db) close() error {
 	if !atomic.CompareAndSwapInt32(&db.closed, 0, 1) {
 		return ErrDBClosed
 	}
 
-	// close idle connections
-	db.closeConnCh <- db.freeConn
+	if db.onClose != nil {
+		db.onClose()
+	}
+
+	db.mu.Lock()
+	freeConn := db.freeConn
+	db.freeConn = nil
+	db.numOpen -= len(freeConn)
+	if db.cleanerCh != nil {
+		close(db.cleanerCh) // stop connCleaner
+		db.cleanerCh = nil
+	}
+	if db.fillerCh != nil {
+		close(db.fillerCh) // stop connFiller
+		db.fillerCh = nil
+	}
+	if db.keepAliveCh != nil {
+		close(db.keepAliveCh) // stop connKeepAlive
+		db.keepAliveCh = nil
+	}
+	db.mu.Unlock()
+
+	db.cancel() // stop pending dials and pings
 
-	// stop connCloser
+	// wait for background go routines before closing connections
+	db.cleanerWg.Wait()
+	db.fillerWg.Wait()
+	db.keepAliveWg.Wait()
+
+	// close idle and shared connections
+	db.closeConnCh <- append(freeConn, db.removeSharedConns()...)
+
+	// stop connCloser - connections are closed synchronously from now on (please see closeConns)
+	db.mu.Lock()
 	close(db.closeConnCh)
+	db.mu.Unlock()
 	// wait for go routines to stop
 	db.wg.Wait()
 	return nil
 }
 
-func (db *db) connCloser(wg *sync.WaitGroup, closeConnCh <-chan []*conn) {
-	for closeConn := range closeConnCh {
-		for _, c := range closeConn {
-			c.mu.Lock()
-			if !c.closed {
-				c.quitLocked()
+// connCleaner closes expired idle connections.
+func (db *db) connCleaner(wg *sync.WaitGroup, cleanerCh <-chan struct{}, d time.Duration) {
+	defer wg.Done()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case _, ok := <-cleanerCh: // lifetime or idle time got shortened
+			if !ok { // db closed
+				return
 			}
 		}
-		for _, c := range closeConn {
-			c.waitClosedLocked()
-			c.mu.Unlock()
+
+		db.mu.Lock()
+		if d = db.cleanerIntervalLocked(); d <= 0 { // lifetime and idle time got reset
+			db.cleanerCh = nil
+			db.mu.Unlock()
+			return
+		}
+		expired := db.expiredConnsLocked(time.Now())
+		db.mu.Unlock()
+
+		if len(expired) > 0 {
+			db.closeConns(expired)
 		}
+		t.Reset(d)
+	}
+}
+
+// connFiller opens connections until the minimum number of idle connections is reached.
+// In case of a dial error the filler waits for being woken up again.
+func (db *db) connFiller(wg *sync.WaitGroup, fillerCh <-chan struct{}) {
+	defer wg.Done()
+
+	for range fillerCh {
+		for db.fillConn() {
+		}
+	}
+}
+
+// fillConn opens an idle connection. It returns false if no connection is needed or the connection could not be opened.
+func (db *db) fillConn() bool {
+	db.mu.Lock()
+	minIdle := db.minIdle
+	if minIdle > db.maxIdle {
+		minIdle = db.maxIdle
+	}
+	if len(db.freeConn) >= minIdle || (db.maxOpen > 0 && db.numOpen >= db.maxOpen) {
+		db.mu.Unlock()
+		return false
+	}
+	db.numOpen++
+	db.mu.Unlock()
+
+	conn, err := db.dialConn(db.ctx)
+	if err != nil {
+		db.mu.Lock()
+		db.discardConnLocked()
+		db.mu.Unlock()
+		return false
+	}
+	conn.Close() // put to pool or handed over to a waiting caller
+	return atomic.LoadInt32(&db.closed) == 0
+}
+
+// connKeepAlive pings idle connections not used or pinged within the keepalive interval d
+// and closes the connections failing the ping.
+func (db *db) connKeepAlive(wg *sync.WaitGroup, keepAliveCh <-chan struct{}, d time.Duration) {
+	defer wg.Done()
+
+	t := time.NewTicker(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-keepAliveCh: // db closed
+			return
+		}
+
+		now := time.Now()
+		var conns []*conn
+		db.mu.Lock()
+		for _, c := range db.freeConn {
+			if now.Sub(c.returnedAt) >= d && now.Sub(c.pingedAt) >= d {
+				c.pingedAt = now
+				conns = append(conns, c)
+			}
+		}
+		db.mu.Unlock()
+
+		if len(conns) > 0 {
+			db.ping(conns, d)
+		}
+	}
+}
+
+// ping sends a PING to the idle connections conns and closes the connections not answering within timeout.
+// Connections are kept in the pool while pinging, as they can be used concurrently.
+func (db *db) ping(conns []*conn, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(db.ctx, timeout)
+	defer cancel()
+
+	results := make([]Result, len(conns))
+	for i, c := range conns {
+		results[i] = c.WithContext(ctx).Ping(nil)
+	}
+
+	errs := make([]error, len(results))
+	for i, r := range results {
+		errs[i] = r.Err()
+	}
+	if db.ctx.Err() != nil { // db closed
+		return
+	}
+
+	var unhealthy []*conn
+	db.mu.Lock()
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		for j, c := range db.freeConn {
+			if c == conns[i] { // still idle - connections in use are checked when put back
+				db.freeConn = append(db.freeConn[:j], db.freeConn[j+1:]...)
+				db.discardConnLocked()
+				db.unhealthyClosed++
+				unhealthy = append(unhealthy, c)
+				break
+			}
+		}
+	}
+	if len(unhealthy) > 0 {
+		db.wakeFillerLocked()
+	}
+	db.mu.Unlock()
+
+	if len(unhealthy) > 0 {
+		db.closeConns(unhealthy)
+	}
+}
+
+// closeConns closes the connections in background by the connection closer. After the database
+// is closed the connections are closed synchronously (e.g. connections in use put back to the pool).
+func (db *db) closeConns(conns []*conn) {
+	db.mu.RLock()
+	if atomic.LoadInt32(&db.closed) == 0 {
+		db.closeConnCh <- conns
+		db.mu.RUnlock()
+		return
+	}
+	db.mu.RUnlock()
+	closeConns(conns)
+}
+
+func (db *db) connCloser(wg *sync.WaitGroup, closeConnCh <-chan []*conn) {
+	for closeConn := range closeConnCh {
+		closeConns(closeConn)
 	}
 	wg.Done()
 }
+
+// closeConns closes the connections and waits until they are closed.
+func closeConns(conns []*conn) {
+	for _, c := range conns {
+		c.mu.Lock()
+		if !c.closed {
+			c.setClosing()
+			c.quitLocked()
+		}
+	}
+	for _, c := range conns {
+		c.waitClosedLocked()
+		c.mu.Unlock()
+	}
+}
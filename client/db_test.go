@@ -0,0 +1,426 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDBConnMaxLifetime(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	db := OpenDB(s.addr(), Dialer{})
+	defer db.Close()
+
+	db.SetConnMaxLifetime(50 * time.Millisecond)
+
+	if err := db.Set("key", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := db.Get("key").Err(); err != nil { // expired connection is closed on checkout
+		t.Fatal(err)
+	}
+
+	stats := db.Stats()
+	if stats.MaxLifetimeClosed != 1 {
+		t.Fatalf("got: %d expected: %d", stats.MaxLifetimeClosed, 1)
+	}
+	if stats.OpenConnections != 1 {
+		t.Fatalf("got: %d expected: %d", stats.OpenConnections, 1)
+	}
+}
+
+func TestDBConnMaxLifetimeWaiter(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{AcquireTimeout: 3 * time.Second})
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(50 * time.Millisecond)
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- db.Set("key", "value").Err() }()
+
+	deadline := time.Now().Add(time.Second)
+	for db.Stats().WaitCount == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	conn.Close() // expired connection is discarded - waiter opens a new connection
+
+	select {
+	case err := <-waitErr:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken up after connection was discarded")
+	}
+	if stats := db.Stats(); stats.MaxLifetimeClosed != 1 || stats.OpenConnections != 1 {
+		t.Fatalf("got: lifetime closed %d open %d expected: lifetime closed 1 open 1", stats.MaxLifetimeClosed, stats.OpenConnections)
+	}
+}
+
+func TestDBConnMaxIdleTime(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	db := OpenDB(s.addr(), Dialer{})
+	defer db.Close()
+
+	db.SetConnMaxIdleTime(10 * time.Millisecond)
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); err != nil { // return connection to pool
+		t.Fatal(err)
+	}
+
+	// wait for connection cleaner
+	deadline := time.Now().Add(3 * minCleanerInterval)
+	for db.Stats().MaxIdleTimeClosed == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := db.Stats()
+	if stats.MaxIdleTimeClosed != 1 {
+		t.Fatalf("got: %d expected: %d", stats.MaxIdleTimeClosed, 1)
+	}
+	if stats.OpenConnections != 0 || stats.Idle != 0 {
+		t.Fatalf("got: open %d idle %d expected: open 0 idle 0", stats.OpenConnections, stats.Idle)
+	}
+}
+
+func TestDBWriteError(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	db := newDB(s.addr(), Dialer{})
+	defer db.Close()
+
+	// pooled connection failing on write
+	fc := newFaultyConn(t, s.addr())
+	conn, err := newConn(db, fc, &db.dialer, s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.mu.Lock()
+	db.numOpen++
+	db.mu.Unlock()
+	conn.Close() // put back to pool
+
+	fc.fail()
+
+	if err := db.Set("key", "value").Err(); err != errFaultyConn {
+		t.Fatalf("got: %v expected: %v", err, errFaultyConn)
+	}
+	// broken connection is discarded
+	if err := db.Set("key", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := db.Stats(); stats.OpenConnections != 1 {
+		t.Fatalf("got: %d expected: %d", stats.OpenConnections, 1)
+	}
+}
+
+func TestDBOptions(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	waitIdle := func(db DB, n int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for db.Stats().Idle != n && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if idle := db.Stats().Idle; idle != n {
+			t.Fatalf("got: %d expected: %d idle connections", idle, n)
+		}
+	}
+
+	t.Run("MinIdleConns", func(t *testing.T) {
+		db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{MinIdleConns: 3})
+		defer db.Close()
+
+		waitIdle(db, 3) // warm up
+
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitIdle(db, 3) // replenished
+		if stats := db.Stats(); stats.OpenConnections != 4 {
+			t.Fatalf("got: %d expected: %d", stats.OpenConnections, 4)
+		}
+		conn.Close() // exceeds maximum number of idle connections
+		if stats := db.Stats(); stats.OpenConnections != 3 {
+			t.Fatalf("got: %d expected: %d", stats.OpenConnections, 3)
+		}
+	})
+
+	t.Run("Order", func(t *testing.T) {
+		for _, order := range []PoolOrder{PoolFIFO, PoolLIFO} {
+			db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{Order: order})
+			defer db.Close()
+
+			c1, err := db.Conn(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			c2, err := db.Conn(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			c1.Close()
+			c2.Close()
+
+			expected := c1
+			if order == PoolLIFO {
+				expected = c2
+			}
+			c, err := db.Conn(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c != expected {
+				t.Fatalf("order %d: unexpected connection reused", order)
+			}
+			c.Close()
+		}
+	})
+
+	t.Run("AcquireTimeout", func(t *testing.T) {
+		db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{AcquireTimeout: 50 * time.Millisecond})
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Set("key", "value").Err(); err != context.DeadlineExceeded {
+			t.Fatalf("got: %v expected: %v", err, context.DeadlineExceeded)
+		}
+		conn.Close()
+		if err := db.Set("key", "value").Err(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("MaxWaiters", func(t *testing.T) {
+		db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{MaxWaiters: 1})
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitErr := make(chan error, 1)
+		go func() { waitErr <- db.Set("key", "value").Err() }()
+
+		deadline := time.Now().Add(time.Second)
+		for db.Stats().WaitCount == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if err := db.Set("key", "value").Err(); err != ErrPoolExhausted {
+			t.Fatalf("got: %v expected: %v", err, ErrPoolExhausted)
+		}
+		conn.Close() // hand over to waiter
+		if err := <-waitErr; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("DialOutsideLock", func(t *testing.T) {
+		dialing, release := make(chan struct{}), make(chan struct{})
+		d := Dialer{DialFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			close(dialing)
+			<-release
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		}}
+		db := OpenDB(s.addr(), d)
+		defer db.Close()
+
+		setErr := make(chan error, 1)
+		go func() { setErr <- db.Set("key", "value").Err() }()
+		<-dialing
+
+		stats := make(chan struct{})
+		go func() { db.Stats(); close(stats) }()
+		select {
+		case <-stats:
+		case <-time.After(time.Second):
+			t.Fatal("pool locked while dialing")
+		}
+		close(release)
+		if err := <-setErr; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDBHealthCheck(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	var hang int32
+	s.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		return strings.ToUpper(cmd[0]) == "PING" && atomic.LoadInt32(&hang) != 0 // no reply
+	}
+
+	waitStats := func(db DB, cond func(stats DBStats) bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond(db.Stats()) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if stats := db.Stats(); !cond(stats) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	}
+
+	breakConn := func(c Conn) {
+		t.Helper()
+		conn := c.(*conn)
+		conn.closeNetConn()
+		deadline := time.Now().Add(time.Second)
+		for !conn.isShutdown() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("Checkout", func(t *testing.T) {
+		db := OpenDB(s.addr(), Dialer{})
+		defer db.Close()
+
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		breakConn(conn) // broken while idle
+
+		if err := db.Set("key", "value").Err(); err != nil { // replaced on checkout
+			t.Fatal(err)
+		}
+
+		conn, err = db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		breakConn(conn) // broken while in use
+		conn.Close()
+
+		if stats := db.Stats(); stats.UnhealthyClosed != 2 || stats.OpenConnections != 0 {
+			t.Fatalf("got: unhealthy %d open %d expected: unhealthy 2 open 0", stats.UnhealthyClosed, stats.OpenConnections)
+		}
+	})
+
+	t.Run("Waiter", func(t *testing.T) {
+		db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{AcquireTimeout: 3 * time.Second})
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitErr := make(chan error, 1)
+		go func() { waitErr <- db.Set("key", "value").Err() }()
+		waitStats(db, func(stats DBStats) bool { return stats.WaitCount == 1 })
+
+		breakConn(conn)
+		conn.Close() // broken connection is discarded - waiter opens a new connection
+
+		select {
+		case err := <-waitErr:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("waiter not woken up after broken connection was discarded")
+		}
+	})
+
+	t.Run("KeepAlive", func(t *testing.T) {
+		db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{MinIdleConns: 1, KeepAliveInterval: 20 * time.Millisecond})
+		defer db.Close()
+
+		waitStats(db, func(stats DBStats) bool { return stats.Idle == 1 })
+		n := s.countCmds("PING")
+		deadline := time.Now().Add(time.Second)
+		for s.countCmds("PING") == n && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if s.countCmds("PING") == n {
+			t.Fatal("keepalive ping not sent")
+		}
+
+		atomic.StoreInt32(&hang, 1)
+		defer atomic.StoreInt32(&hang, 0)
+
+		// connection not answering the ping is replaced
+		waitStats(db, func(stats DBStats) bool { return stats.UnhealthyClosed >= 1 && stats.Idle == 1 })
+	})
+}
+
+func TestDBCloseInflight(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	newTxHandler(s, 0)
+
+	db := OpenDB(s.addr(), Dialer{})
+
+	var c *conn
+	err := db.Tx(context.Background(), []interface{}{"key"}, func(t Tx) error {
+		c = t.(*tx).queue.c
+		db.Close() // connection in use is closed when put back to the pool
+		t.Queue().Set("key", "value")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.isShutdown() {
+		t.Fatal("connection not closed")
+	}
+	if err := db.Set("key", "value").Err(); err != ErrDBClosed {
+		t.Fatalf("got: %v expected: %v", err, ErrDBClosed)
+	}
+}
@@ -25,20 +25,50 @@ import (
 )
 
 // InvalidateCallback is the function type for the Redis cache invalidate callback function.
+// Keys are nil in case all keys need to be invalidated, which is the case if
+// - the Redis database was flushed,
+// - the tracking redirection connection got lost (tracking-redir-broken) or
+// - the connection got lost or closed (tracking information is not available anymore).
 type InvalidateCallback func(keys []string)
 
 // MonitorCallback is the function type for the Redis monitor callback function.
 type MonitorCallback func(time time.Time, db int64, addr string, cmds []string)
 
+// PushCallback is the function type for the Redis push notification callback function.
+// It is called for all push notifications not handled by the client itself
+// (e.g. push notifications sent by Redis modules or by newer Redis versions).
+// The values do not include the push notification kind.
+type PushCallback func(kind string, values []RedisValue)
+
 // TraceCallback is the function type for the tracing callback function.
 type TraceCallback func(dir bool, b []byte)
 
+// DialFunc is the function type for dialing the network connection to a Redis server.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
 // SendInterceptor is the function type for the send interceptor function.
 type SendInterceptor func(name string, values []interface{})
 
+// ProtocolMode defines the RESP protocol version negotiation of a connection.
+type ProtocolMode int
+
+// Protocol modes.
+const (
+	// ProtocolRESP3 requires RESP3 - connecting fails if the server rejects HELLO 3.
+	ProtocolRESP3 ProtocolMode = iota
+	// ProtocolFallback uses RESP3 and falls back to RESP2 if the server rejects HELLO 3
+	// (e.g. Redis versions before 6 or proxies not supporting RESP3).
+	ProtocolFallback
+	// ProtocolRESP2 uses RESP2 without sending HELLO (e.g. for proxies closing the connection on unknown commands).
+	ProtocolRESP2
+)
+
 //Dialer contains options for connecting to a redis server.
 type Dialer struct {
 	net.Dialer
+	// Custom function dialing the network connection (e.g. custom transports) - nil means net.Dialer.DialContext.
+	// The connection is wrapped by a TLS client connection if TLSConfig is set.
+	DialFunc DialFunc
 	// TLS
 	TLSConfig *tls.Config
 	// Connection logging.
@@ -51,15 +81,46 @@ type Dialer struct {
 	Username, Password string
 	// Redis client name.
 	ClientName string
+	// Database selected after connecting - zero means the default database.
+	DB int
 	// Client cache invalidation callback.
 	InvalidateCallback InvalidateCallback
 	// Monitor callback.
 	MonitorCallback MonitorCallback
+	// Callback for push notifications not handled by the client.
+	PushCallback PushCallback
 	// Callback function tracing Redis commands and results on RESP3 protocol level.
 	// Direction dir is true for sent bytes b (commands), false for received bytes b (results).
 	TraceCallback TraceCallback
 	// Command interceptor (debugging).
 	SendInterceptor SendInterceptor
+	// Decode arrays, sets and maps of replies into pooled memory (reply arena) to reduce allocations.
+	// The memory is returned to the pool by Result.Release or after the result value was converted by
+	// a result conversion method not returning Redis values (please see Result.Release).
+	// Replies are not decoded into an arena if TraceCallback is set.
+	ReplyArena bool
+	// Automatic reconnect after a lost connection (network or protocol error).
+	// After reconnecting the connection state (authentication, client name, selected database,
+	// client tracking and pubsub subscriptions) gets restored. Commands in flight while the
+	// connection got lost are failing with a ConnLostError.
+	Reconnect bool
+	// Maximum number of consecutive reconnect attempts - zero means unlimited.
+	MaxReconnectAttempts int
+	// Backoff policy for reconnect attempts - nil means DefaultBackoff.
+	ReconnectBackoff Backoff
+	// RESP protocol negotiation - default is ProtocolRESP3.
+	// Using RESP2
+	// - the connection is authenticated by AUTH and the client name is set by CLIENT SETNAME,
+	// - RESP2 replies are decoded into the RESP3 value kinds where the command reply type is known
+	//   (e.g. the flat array reply of HGETALL is returned as map),
+	// - a connection subscribing to channels is dedicated to pubsub (please see Subscriber),
+	//   as RESP2 pubsub messages cannot be distinguished from command replies and
+	// - client side caching and push notifications are not supported.
+	Protocol ProtocolMode
+
+	pool *poolLimits // connection pool limits applied by OpenDB (please see ParseURL) - nil otherwise
+
+	subscriptionCallback func(count int64) // subscription count callback of a Subscriber - nil otherwise
 }
 
 func (d *Dialer) channelSize() int {
@@ -73,22 +134,54 @@ func (d *Dialer) channelSize() int {
 }
 
 // Dial connects to the redis server address.
+// The address is a host:port address or an URL (please see ParseURL).
+// The options provided by the URL take precedence over the corresponding Dialer attributes.
 func (d *Dialer) Dial(address string) (Conn, error) {
 	return d.DialContext(context.Background(), address)
 }
 
 // DialContext connects to the redis server address using the provided context.
+// Please see Dial for the address format.
 func (d *Dialer) DialContext(ctx context.Context, address string) (Conn, error) {
 	return d.dialContext(ctx, address)
 }
 
 func (d *Dialer) dialContext(ctx context.Context, address string) (*conn, error) {
-	c, err := d.Dialer.DialContext(ctx, tcpNetwork, hostPort(address))
+	a, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	d = a.dialer(d)
+	c, err := d.dialNetConn(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(nil, c, d, address)
+}
+
+func (d *Dialer) dialNetConn(ctx context.Context, address string) (net.Conn, error) {
+	a, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	var c net.Conn
+	if d.DialFunc != nil {
+		c, err = d.DialFunc(ctx, a.network, a.address)
+	} else {
+		c, err = d.Dialer.DialContext(ctx, a.network, a.address)
+	}
 	if err != nil {
 		return nil, err
 	}
 	if d.TLSConfig != nil {
 		c = tls.Client(c, d.TLSConfig)
 	}
-	return newConn(nil, c, d)
+	return c, nil
+}
+
+func (d *Dialer) reconnectBackoff() Backoff {
+	if d.ReconnectBackoff == nil {
+		return DefaultBackoff
+	}
+	return d.ReconnectBackoff
 }
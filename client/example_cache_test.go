@@ -0,0 +1,57 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/stfnmllr/go-resp3/client"
+)
+
+func Example_cache() {
+	mykey := client.RandomKey("mykey")
+
+	// Open cache using a connection pool and a dedicated invalidation connection.
+	cache, err := client.OpenCache(context.Background(), "", client.Dialer{}, client.CacheOptions{Redirect: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cache.Close()
+
+	if err := cache.Set(mykey, "Hello Redis").Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	// First read is sent to Redis, second read is served by the cache.
+	for i := 0; i < 2; i++ {
+		val, err := cache.Get(mykey).ToString()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(val)
+	}
+
+	stats := cache.Stats()
+	fmt.Println(stats.Hits, stats.Misses)
+
+	// Output:
+	// Hello Redis
+	// Hello Redis
+	// 1 1
+}
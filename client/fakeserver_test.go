@@ -0,0 +1,350 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer is a minimal RESP3 (or RESP2) server for testing connection handling without a Redis server.
+type fakeServer struct {
+	resp2  bool // RESP2 server rejecting HELLO
+	ln     net.Listener
+	mu     sync.Mutex
+	conns  []net.Conn
+	kv     map[string]string
+	hashes map[string]map[string]string
+	cmds   []string
+	subs   map[net.Conn][]string
+	handle func(c net.Conn, w *bufio.Writer, cmd []string) bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer { return startFakeServer(t, "tcp", "127.0.0.1:0", false) }
+
+func newRESP2FakeServer(t *testing.T) *fakeServer {
+	return startFakeServer(t, "tcp", "127.0.0.1:0", true)
+}
+
+// newUnixFakeServer returns a fake server listening on unix domain socket path.
+func newUnixFakeServer(t *testing.T, path string) *fakeServer {
+	return startFakeServer(t, "unix", path, false)
+}
+
+func startFakeServer(t *testing.T, network, address string, resp2 bool) *fakeServer {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{resp2: resp2, ln: ln, kv: map[string]string{}, hashes: map[string]map[string]string{}, subs: map[net.Conn][]string{}}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, c)
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.ln.Addr().String() }
+
+// pushHeader writes the header of a push notification with n elements.
+func (s *fakeServer) pushHeader(w *bufio.Writer, n int) {
+	if s.resp2 {
+		fmt.Fprintf(w, "*%d\r\n", n)
+	} else {
+		fmt.Fprintf(w, ">%d\r\n", n)
+	}
+}
+
+// mapHeader writes the header of a map with n entries.
+func (s *fakeServer) mapHeader(w *bufio.Writer, n int) {
+	if s.resp2 {
+		fmt.Fprintf(w, "*%d\r\n", 2*n)
+	} else {
+		fmt.Fprintf(w, "%%%d\r\n", n)
+	}
+}
+
+// null writes a null value.
+func (s *fakeServer) null(w *bufio.Writer) {
+	if s.resp2 {
+		w.WriteString("$-1\r\n")
+	} else {
+		w.WriteString("_\r\n")
+	}
+}
+
+func (s *fakeServer) dropAll() {
+	s.mu.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+	s.mu.Unlock()
+}
+
+// publish sends a pubsub message to all connections.
+func (s *fakeServer) publish(channel, msg string) { s.message("message", channel, msg) }
+
+// spublish sends a sharded pubsub message to all connections.
+func (s *fakeServer) spublish(channel, msg string) { s.message("smessage", channel, msg) }
+
+func (s *fakeServer) message(kind, channel, msg string) {
+	s.mu.Lock()
+	conns := append([]net.Conn(nil), s.conns...)
+	s.mu.Unlock()
+	for _, c := range conns {
+		w := bufio.NewWriter(c)
+		s.pushHeader(w, 3)
+		bulk(w, kind)
+		bulk(w, channel)
+		bulk(w, msg)
+		w.Flush()
+	}
+}
+
+// invalidate sends an invalidation message to all connections - nil keys invalidate all keys.
+func (s *fakeServer) invalidate(keys []string) {
+	s.mu.Lock()
+	conns := append([]net.Conn(nil), s.conns...)
+	s.mu.Unlock()
+	for _, c := range conns {
+		w := bufio.NewWriter(c)
+		w.WriteString(">2\r\n")
+		bulk(w, "invalidate")
+		if keys == nil {
+			w.WriteString("_\r\n")
+		} else {
+			fmt.Fprintf(w, "*%d\r\n", len(keys))
+			for _, key := range keys {
+				bulk(w, key)
+			}
+		}
+		w.Flush()
+	}
+}
+
+// push sends raw RESP3 data to all connections.
+func (s *fakeServer) push(data string) {
+	s.mu.Lock()
+	conns := append([]net.Conn(nil), s.conns...)
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.Write([]byte(data))
+	}
+}
+
+// ppublish sends a pubsub pattern message to all connections.
+func (s *fakeServer) ppublish(pattern, channel, msg string) {
+	s.mu.Lock()
+	conns := append([]net.Conn(nil), s.conns...)
+	s.mu.Unlock()
+	for _, c := range conns {
+		w := bufio.NewWriter(c)
+		s.pushHeader(w, 4)
+		bulk(w, "pmessage")
+		bulk(w, pattern)
+		bulk(w, channel)
+		bulk(w, msg)
+		w.Flush()
+	}
+}
+
+// subscription keys are prefixed by the subscription kind (subscribe, psubscribe, ssubscribe).
+func subscriptionKey(kind, ch string) string { return strings.Replace(kind, "un", "", 1) + ":" + ch }
+
+// subscribe adds a subscription and returns the number of subscriptions of connection c.
+func (s *fakeServer) subscribe(c net.Conn, kind, ch string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := subscriptionKey(kind, ch)
+	for _, sub := range s.subs[c] {
+		if sub == key {
+			return len(s.subs[c])
+		}
+	}
+	s.subs[c] = append(s.subs[c], key)
+	return len(s.subs[c])
+}
+
+// unsubscribe removes a subscription and returns the number of subscriptions of connection c.
+func (s *fakeServer) unsubscribe(c net.Conn, kind, ch string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := subscriptionKey(kind, ch)
+	subs := s.subs[c][:0]
+	for _, sub := range s.subs[c] {
+		if sub != key {
+			subs = append(subs, sub)
+		}
+	}
+	s.subs[c] = subs
+	return len(subs)
+}
+
+// subscriptions returns the channels or patterns subscribed by connection c.
+func (s *fakeServer) subscriptions(c net.Conn, kind string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var chs []string
+	prefix := subscriptionKey(kind, "")
+	for _, sub := range s.subs[c] {
+		if strings.HasPrefix(sub, prefix) {
+			chs = append(chs, strings.TrimPrefix(sub, prefix))
+		}
+	}
+	return chs
+}
+
+func bulk(w *bufio.Writer, s string) { fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s) }
+
+func (s *fakeServer) serve(c net.Conn) {
+	dec := NewDecoder(c)
+	w := bufio.NewWriter(c)
+	for {
+		v, err := dec.Decode()
+		if err != nil {
+			c.Close()
+			return
+		}
+		sl, ok := v.(_slice)
+		if !ok {
+			c.Close()
+			return
+		}
+		cmd, _ := sl.ToStringSlice()
+		s.mu.Lock()
+		s.cmds = append(s.cmds, strings.Join(cmd, " "))
+		s.mu.Unlock()
+		if s.handle != nil && s.handle(c, w, cmd) {
+			w.Flush()
+			continue
+		}
+		switch strings.ToUpper(cmd[0]) {
+		case "HELLO":
+			if s.resp2 {
+				w.WriteString("-ERR unknown command 'HELLO'\r\n")
+			} else {
+				w.WriteString("%1\r\n+version\r\n+6.0.5\r\n")
+			}
+		case "SET":
+			s.mu.Lock()
+			s.kv[cmd[1]] = cmd[2]
+			s.mu.Unlock()
+			w.WriteString("+OK\r\n")
+		case "GET":
+			s.mu.Lock()
+			v, ok := s.kv[cmd[1]]
+			s.mu.Unlock()
+			if ok {
+				bulk(w, v)
+			} else {
+				s.null(w)
+			}
+		case "HSET":
+			s.mu.Lock()
+			h, ok := s.hashes[cmd[1]]
+			if !ok {
+				h = map[string]string{}
+				s.hashes[cmd[1]] = h
+			}
+			n := 0
+			for i := 2; i+1 < len(cmd); i += 2 {
+				if _, ok := h[cmd[i]]; !ok {
+					n++
+				}
+				h[cmd[i]] = cmd[i+1]
+			}
+			s.mu.Unlock()
+			fmt.Fprintf(w, ":%d\r\n", n)
+		case "HGETALL":
+			s.mu.Lock()
+			h := s.hashes[cmd[1]]
+			s.mapHeader(w, len(h))
+			for field, value := range h {
+				bulk(w, field)
+				bulk(w, value)
+			}
+			s.mu.Unlock()
+		case "HMGET":
+			s.mu.Lock()
+			h := s.hashes[cmd[1]]
+			fmt.Fprintf(w, "*%d\r\n", len(cmd)-2)
+			for _, field := range cmd[2:] {
+				if value, ok := h[field]; ok {
+					bulk(w, value)
+				} else {
+					s.null(w)
+				}
+			}
+			s.mu.Unlock()
+		case "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE":
+			kind := strings.ToLower(cmd[0])
+			for _, ch := range cmd[1:] {
+				s.pushHeader(w, 3)
+				bulk(w, kind)
+				bulk(w, ch)
+				fmt.Fprintf(w, ":%d\r\n", s.subscribe(c, kind, ch))
+			}
+		case "UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE":
+			kind := strings.ToLower(cmd[0])
+			chs := cmd[1:]
+			if len(chs) == 0 {
+				chs = s.subscriptions(c, kind)
+			}
+			if len(chs) == 0 {
+				s.pushHeader(w, 3)
+				bulk(w, kind)
+				s.null(w)
+				w.WriteString(":0\r\n")
+			}
+			for _, ch := range chs {
+				s.pushHeader(w, 3)
+				bulk(w, kind)
+				bulk(w, ch)
+				fmt.Fprintf(w, ":%d\r\n", s.unsubscribe(c, kind, ch))
+			}
+		case "PUBLISH":
+			w.WriteString(":1\r\n")
+			w.Flush()
+			s.publish(cmd[1], cmd[2])
+		case "SPUBLISH":
+			w.WriteString(":1\r\n")
+			w.Flush()
+			s.spublish(cmd[1], cmd[2])
+		case "QUIT":
+			w.WriteString("+OK\r\n")
+			w.Flush()
+			c.Close()
+			return
+		default:
+			w.WriteString("+OK\r\n")
+		}
+		w.Flush()
+	}
+}
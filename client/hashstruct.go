@@ -0,0 +1,209 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+)
+
+// HashStructCommands are the commands storing Go structs as Redis hashes.
+//
+// Struct fields are mapped to hash fields by the field tag `redis:"name,option..."`
+// (please see function Scan). Supported options are
+// - omitempty: fields with zero values are not stored,
+// - json:      the field value is stored JSON encoded (e.g. nested structs, slices and maps).
+// Nil pointer fields are not stored.
+//
+// The destination of HgetallInto and HmgetInto is set after the result is available,
+// so in case of pipelines the destination must not be accessed before the pipeline
+// is flushed and the result error is checked.
+type HashStructCommands interface {
+	// HsetStruct stores the fields of struct v in the hash at key (HSET).
+	// If field names are provided, only these fields are stored (partial update).
+	HsetStruct(key, v interface{}, fields ...string) Result
+	// HgetallInto loads all fields of the hash at key into the struct dst points to (HGETALL).
+	HgetallInto(key, dst interface{}) Result
+	// HmgetInto loads the fields of the hash at key into the struct dst points to (HMGET).
+	// If no field names are provided, all struct fields are loaded.
+	// Struct fields without corresponding hash field are left unchanged.
+	HmgetInto(key, dst interface{}, fields ...string) Result
+}
+
+// HsetStruct stores the fields of struct v in the hash at key (HSET).
+// If field names are provided, only these fields are stored (partial update).
+func (c *command) HsetStruct(key, v interface{}, fields ...string) Result {
+	r := newResult()
+	fieldValues, err := hashFieldValues(v, fields)
+	if err != nil {
+		r.setErr(err)
+		return r
+	}
+	if len(fieldValues) == 0 {
+		r.setErr(newInvalidValueError("v", v))
+		return r
+	}
+	r.request.cmd = append(r.request.cmd, "HSET", key)
+	for _, fv := range fieldValues {
+		r.request.cmd = append(r.request.cmd, fv.Field, fv.Value)
+	}
+	c.send(CmdHset, r)
+	return r
+}
+
+// HgetallInto loads all fields of the hash at key into the struct dst points to (HGETALL).
+func (c *command) HgetallInto(key, dst interface{}) Result {
+	r := newResult()
+	if _, ok := structPtr(dst); !ok {
+		r.setErr(newInvalidValueError("dst", dst))
+		return r
+	}
+	r.request.cmd = append(r.request.cmd, "HGETALL", key)
+	r.request.onAck = func(value RedisValue, err error) error {
+		if err != nil {
+			return err
+		}
+		return Scan(value, dst)
+	}
+	c.send(CmdHgetall, r)
+	return r
+}
+
+// HmgetInto loads the fields of the hash at key into the struct dst points to (HMGET).
+// If no field names are provided, all struct fields are loaded.
+// Struct fields without corresponding hash field are left unchanged.
+func (c *command) HmgetInto(key, dst interface{}, fields ...string) Result {
+	r := newResult()
+	t, ok := structPtr(dst)
+	if !ok {
+		r.setErr(newInvalidValueError("dst", dst))
+		return r
+	}
+	if len(fields) == 0 {
+		for _, f := range structFields(t) {
+			fields = append(fields, f.name)
+		}
+	}
+	if len(fields) == 0 {
+		r.setErr(newInvalidValueError("fields", fields))
+		return r
+	}
+	r.request.cmd = append(r.request.cmd, "HMGET", key)
+	for _, field := range fields {
+		r.request.cmd = append(r.request.cmd, field)
+	}
+	r.request.onAck = func(value RedisValue, err error) error {
+		if err != nil {
+			return err
+		}
+		values, ok := value.(_slice)
+		if !ok || len(values) != len(fields) {
+			return newConversionError("HmgetInto", value)
+		}
+		items := make(_map, 0, len(fields))
+		for i, v := range values {
+			if v.Kind() != RkNull { // hash field does not exist
+				items = append(items, MapItem{Key: _string(fields[i]), Value: v})
+			}
+		}
+		return Scan(items, dst)
+	}
+	c.send(CmdHmget, r)
+	return r
+}
+
+// structPtr returns the struct type v is pointing to.
+func structPtr(v interface{}) (reflect.Type, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	return rv.Elem().Type(), true
+}
+
+// hashFieldValues returns the hash field values of struct v.
+func hashFieldValues(v interface{}, fields []string) ([]FieldValue, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, &InvalidTypeError{v}
+	}
+
+	structFields := structFields(rv.Type())
+
+	var selected map[string]bool
+	if len(fields) != 0 {
+		selected = make(map[string]bool, len(fields))
+		for _, name := range fields {
+			if _, ok := structFields.lookup(name); !ok {
+				return nil, newInvalidValueError("fields", name)
+			}
+			selected[name] = true
+		}
+	}
+
+	fieldValues := make([]FieldValue, 0, len(structFields))
+	for _, f := range structFields {
+		if selected != nil && !selected[f.name] {
+			continue
+		}
+		fv := rv.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		value, ok, err := hashValue(fv, f.json)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			fieldValues = append(fieldValues, FieldValue{Field: f.name, Value: value})
+		}
+	}
+	return fieldValues, nil
+}
+
+// hashValue returns the value to be stored in a hash field - ok is false for nil values.
+func hashValue(v reflect.Value, asJSON bool) (interface{}, bool, error) {
+	if asJSON {
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, false, err
+		}
+		return string(b), true, nil
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		v = v.Elem()
+	}
+
+	x := v.Interface()
+	switch {
+	case v.CanAddr(): // methods with pointer receiver
+		x = v.Addr().Interface()
+	case v.Type() == bigIntType:
+		i := x.(big.Int)
+		x = &i
+	}
+	s, err := argString(x)
+	if err != nil {
+		return nil, false, err
+	}
+	return s, true, nil
+}
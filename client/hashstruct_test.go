@@ -0,0 +1,125 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type hashAddress struct {
+	City string
+	Zip  string
+}
+
+type hashUser struct {
+	Name     string            `redis:"name"`
+	Age      int               `redis:"age,omitempty"`
+	Admin    bool              `redis:"admin"`
+	Created  time.Time         `redis:"created"`
+	Address  hashAddress       `redis:"address,json"`
+	Labels   map[string]string `redis:"labels,json,omitempty"`
+	Nickname *string           `redis:"nickname"`
+	Ignored  string            `redis:"-"`
+}
+
+func TestHashStruct(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	conn, err := Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	created := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	user := hashUser{
+		Name:    "Alice",
+		Admin:   true,
+		Created: created,
+		Address: hashAddress{City: "Berlin", Zip: "10115"},
+		Ignored: "ignored",
+	}
+	if err := conn.HsetStruct("user:1", &user).Err(); err != nil {
+		t.Fatal(err)
+	}
+	const hset = `HSET user:1 name Alice admin true created 2020-06-01T12:00:00Z address {"City":"Berlin","Zip":"10115"}`
+	if n := s.countCmds(strings.ToUpper(hset)); n != 1 {
+		t.Fatalf("command %s not sent", hset)
+	}
+
+	// partial update
+	user.Age = 42
+	user.Name = "Bob"
+	if err := conn.HsetStruct("user:1", user, "age").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.countCmds("HSET USER:1 AGE 42"); n != 1 {
+		t.Fatal("partial update not sent")
+	}
+
+	var loaded hashUser
+	if err := conn.HgetallInto("user:1", &loaded).Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := user
+	expected.Name = "Alice"
+	expected.Ignored = ""
+	if !reflect.DeepEqual(loaded, expected) {
+		t.Fatalf("got: %v expected: %v", loaded, expected)
+	}
+
+	// pipeline and partial load
+	p := conn.Pipeline()
+	partial := hashUser{Name: "unchanged"}
+	r1 := p.HmgetInto("user:1", &partial, "age", "address")
+	var all hashUser
+	r2 := p.HmgetInto("user:1", &all)
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []Result{r1, r2} {
+		if err := r.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if partial.Name != "unchanged" || partial.Age != 42 || partial.Address != user.Address {
+		t.Fatalf("unexpected partial load %v", partial)
+	}
+	if !reflect.DeepEqual(all, expected) {
+		t.Fatalf("got: %v expected: %v", all, expected)
+	}
+}
+
+func TestHashStructInvalid(t *testing.T) {
+	c := newCommand(func(name string, r *result) { t.Fatalf("unexpected command %v", r.cmd()) }, nil)
+
+	for _, r := range []Result{
+		c.HsetStruct("key", "no struct"),
+		c.HsetStruct("key", struct{ C chan int }{}),
+		c.HsetStruct("key", hashUser{}, "unknown"),
+		c.HgetallInto("key", hashUser{}),
+		c.HmgetInto("key", nil),
+	} {
+		if r.Err() == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
@@ -90,6 +90,9 @@ const (
 )
 
 func nanoSeconds(fraction int64) int64 {
+	if fraction <= 0 {
+		return 0
+	}
 	if fraction < pow10_8 {
 		for fraction < pow10_8 {
 			fraction *= 10
@@ -108,10 +111,10 @@ const (
 )
 
 func parseQuotedString(b []byte) ([]byte, string, bool) {
-	if b[0] != quote {
+	if len(b) < 2 || b[0] != quote {
 		return nil, "", false
 	}
-	buf := make([]byte, len(b)-2)
+	buf := make([]byte, len(b)-1)
 	j, escaped := 0, false
 	for i := 1; i < len(b); i++ {
 		switch b[i] {
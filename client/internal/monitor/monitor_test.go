@@ -28,9 +28,23 @@ var parseTest = []struct {
 	{`1339518083.107412 [0 127.0.0.1:60866] "keys" "*"`, &Notification{time.Unix(1339518083, 107412000), 0, "127.0.0.1:60866", []string{"keys", "*"}}},
 	{`1339518087.877697 [5 127.0.0.1:60866] "dbsize"`, &Notification{time.Unix(1339518087, 877697000), 5, "127.0.0.1:60866", []string{"dbsize"}}},
 	{`1339518090.420270 [15 127.0.0.1:60866] "set" "\"x" "6"`, &Notification{time.Unix(1339518090, 420270000), 15, "127.0.0.1:60866", []string{"set", "\"x", "6"}}},
+	{`1339518090.000000 [0 127.0.0.1:60866] "ping"`, &Notification{time.Unix(1339518090, 0), 0, "127.0.0.1:60866", []string{"ping"}}},
+}
+
+var invalidParseTest = []string{
+	`1339518083.107412 [0 127.0.0.1:60866] "keys`,
+	`1339518083.107412 [0 127.0.0.1:60866] "keys" "`,
+	`1339518083.107412 [0 127.0.0.1:60866] "keys" `,
+	`1339518083.107412 [0 127.0.0.1:60866]  keys"`,
 }
 
 func TestParser(t *testing.T) {
+	for _, s := range invalidParseTest {
+		if _, ok := Parse([]byte(s)); ok {
+			t.Fatalf("invalid notification %s parsed", s)
+		}
+	}
+
 	for i, test := range parseTest {
 		n, ok := Parse([]byte(test.s))
 		if !ok {
@@ -0,0 +1,245 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// BalancePolicy defines how the commands of a multiplexed database are distributed over the shared connections.
+type BalancePolicy int
+
+// Balance policies.
+const (
+	// BalanceRoundRobin uses the shared connections in turn.
+	BalanceRoundRobin BalancePolicy = iota
+	// BalanceLeastInflight uses the shared connection with the least number of pending commands.
+	BalanceLeastInflight
+)
+
+// ErrConnStateCommand is returned by a multiplexed database for commands changing the connection state
+// (e.g. SUBSCRIBE, MONITOR, MULTI, WATCH, SELECT). Please use a connection (Conn) or an optimistic transaction (Tx) instead.
+var ErrConnStateCommand = errors.New(ClientName + ": connection state changing command not supported by multiplexed database")
+
+// dedicatedCommands are the blocking commands, which are not multiplexed. They are executed on
+// a pooled connection which is not released before the command result is available.
+var dedicatedCommands = map[string]bool{
+	CmdBlpop: true, CmdBrpop: true, CmdBrpoplpush: true, CmdBzpopmax: true, CmdBzpopmin: true, CmdWait: true,
+}
+
+// connStateCommands are the commands changing the connection state. As neither a shared nor
+// a pooled connection can be used afterwards, they are rejected by a multiplexed database.
+var connStateCommands = map[string]bool{
+	// pubsub and monitor
+	CmdSubscribe: true, CmdUnsubscribe: true, CmdPsubscribe: true, CmdPunsubscribe: true, CmdSsubscribe: true, CmdSunsubscribe: true, CmdMonitor: true,
+	// transactions and connection state
+	CmdMulti: true, CmdExec: true, CmdDiscard: true, CmdWatch: true, CmdUnwatch: true, CmdSelect: true, CmdQuit: true,
+}
+
+// commandTokens returns the Redis command tokens of commands (generic commands - please see Do).
+func commandTokens(commands map[string]bool) map[string]bool {
+	tokens := make(map[string]bool, len(commands))
+	for name := range commands {
+		tokens[strings.ToUpper(name)] = true
+	}
+	return tokens
+}
+
+var (
+	dedicatedTokens = commandTokens(dedicatedCommands)
+	connStateTokens = commandTokens(connStateCommands)
+)
+
+// doToken returns the upper case Redis command token of a generic command.
+func doToken(name string, cmd []interface{}) (string, bool) {
+	if name != CmdDo || len(cmd) == 0 {
+		return "", false
+	}
+	token, ok := cmd[0].(string)
+	return strings.ToUpper(token), ok
+}
+
+// isDedicated returns true if the command needs to be executed on a dedicated connection.
+func isDedicated(name string, cmd []interface{}) bool {
+	if token, ok := doToken(name, cmd); ok {
+		if token == "XREAD" || token == "XREADGROUP" {
+			return isBlockingRead(cmd[1:])
+		}
+		return dedicatedTokens[token]
+	}
+	switch name {
+	case CmdXread, CmdXreadgroup:
+		return isBlockingRead(cmd[1:])
+	default:
+		return dedicatedCommands[name]
+	}
+}
+
+// isConnState returns true if the command changes the connection state.
+func isConnState(name string, cmd []interface{}) bool {
+	if token, ok := doToken(name, cmd); ok {
+		return connStateTokens[token]
+	}
+	return connStateCommands[name]
+}
+
+// isBlockingRead returns true if the XREAD or XREADGROUP arguments include the BLOCK option.
+func isBlockingRead(args []interface{}) bool {
+	for _, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(s) {
+		case "BLOCK":
+			return true
+		case "STREAMS": // keys and ids are following
+			return false
+		}
+	}
+	return false
+}
+
+// A sharedConn is a connection slot of a multiplexed database.
+type sharedConn struct {
+	inflight int64 // number of pending commands (atomic access)
+
+	mu   sync.RWMutex
+	conn *conn // nil if not connected
+}
+
+// sendNotify sends r via send and calls done once after the result is acknowledged
+// or failed before being sent (e.g. connection in shutdown).
+func sendNotify(send sendFct, name string, r *result, done func()) {
+	var called int32
+	notify := func() {
+		if atomic.CompareAndSwapInt32(&called, 0, 1) {
+			done()
+		}
+	}
+	r.request.onDone = notify
+	send(name, r)
+	if atomic.LoadUint32(&r.flags) == rsAvailable { // already acknowledged or failed
+		notify()
+	}
+}
+
+// sendDedicated sends r on a pooled connection which is released after the result is available.
+func (db *db) sendDedicated(name string, r *result) {
+	conn := db.acquireConn(r)
+	if conn == nil {
+		return
+	}
+	sendNotify(conn.send, name, r, func() { go db.releaseConn(conn) }) // do not block the connection handler
+}
+
+// sendShared sends r on one of the shared connections of a multiplexed database.
+func (db *db) sendShared(name string, r *result) {
+	slot := db.sharedSlot()
+	conn, err := db.sharedConn(r, slot)
+	if err != nil {
+		r.setErr(err)
+		return
+	}
+	atomic.AddInt64(&slot.inflight, 1)
+	sendNotify(conn.send, name, r, func() { atomic.AddInt64(&slot.inflight, -1) })
+}
+
+// sharedSlot selects the shared connection slot according to the balance policy.
+func (db *db) sharedSlot() *sharedConn {
+	if db.balance == BalanceLeastInflight {
+		slot := db.shared[0]
+		min := atomic.LoadInt64(&slot.inflight)
+		for _, s := range db.shared[1:] {
+			if n := atomic.LoadInt64(&s.inflight); n < min {
+				slot, min = s, n
+			}
+		}
+		return slot
+	}
+	i := atomic.AddUint32(&db.next, 1)
+	return db.shared[i%uint32(len(db.shared))]
+}
+
+// sharedConn returns the connection of slot. A missing or broken connection is replaced
+// by a new connection.
+func (db *db) sharedConn(r *result, slot *sharedConn) (*conn, error) {
+	slot.mu.RLock()
+	c := slot.conn
+	slot.mu.RUnlock()
+	if c != nil && !c.isShutdown() {
+		return c, nil
+	}
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	if atomic.LoadInt32(&db.closed) != 0 {
+		return nil, ErrDBClosed
+	}
+	if slot.conn != nil {
+		if !slot.conn.isShutdown() { // replaced concurrently
+			return slot.conn, nil
+		}
+		db.mu.Lock()
+		db.unhealthyClosed++
+		db.mu.Unlock()
+		db.closeConns([]*conn{slot.conn})
+		slot.conn = nil
+	}
+
+	ctx, cancel := db.acquireContext(r)
+	defer cancel()
+
+	c, err := db.dialConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.db = nil // not pooled
+	slot.conn = c
+	return c, nil
+}
+
+// removeSharedConns removes the shared connections from their slots returning the removed connections.
+func (db *db) removeSharedConns() []*conn {
+	var conns []*conn
+	for _, slot := range db.shared {
+		slot.mu.Lock()
+		if slot.conn != nil {
+			conns = append(conns, slot.conn)
+			slot.conn = nil
+		}
+		slot.mu.Unlock()
+	}
+	return conns
+}
+
+// numShared returns the number of open shared connections.
+func (db *db) numShared() int {
+	n := 0
+	for _, slot := range db.shared {
+		slot.mu.RLock()
+		if slot.conn != nil {
+			n++
+		}
+		slot.mu.RUnlock()
+	}
+	return n
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIsDedicated(t *testing.T) {
+	block := int64(100)
+
+	tests := []struct {
+		name      string
+		cmd       []interface{}
+		dedicated bool
+	}{
+		{CmdGet, []interface{}{"GET", "key"}, false},
+		{CmdBlpop, []interface{}{"BLPOP", "key", 0}, true},
+		{CmdMulti, []interface{}{"MULTI"}, false},
+		{CmdSubscribe, []interface{}{"SUBSCRIBE", "channel"}, false},
+		{CmdXread, []interface{}{"XREAD", "COUNT", 1, "STREAMS", "block", "0"}, false},
+		{CmdXread, []interface{}{"XREAD", "BLOCK", &block, "STREAMS", "key", "0"}, true},
+		{CmdDo, []interface{}{"brpop", "key", 0}, true},
+		{CmdDo, []interface{}{"xreadgroup", "GROUP", "g", "c", "block", 0, "STREAMS", "key", ">"}, true},
+		{CmdDo, []interface{}{"set", "key", "value"}, false},
+	}
+	for _, test := range tests {
+		if dedicated := isDedicated(test.name, test.cmd); dedicated != test.dedicated {
+			t.Fatalf("%v: got: %t expected: %t", test.cmd, dedicated, test.dedicated)
+		}
+	}
+}
+
+func TestIsConnState(t *testing.T) {
+	tests := []struct {
+		name      string
+		cmd       []interface{}
+		connState bool
+	}{
+		{CmdGet, []interface{}{"GET", "key"}, false},
+		{CmdBlpop, []interface{}{"BLPOP", "key", 0}, false},
+		{CmdSubscribe, []interface{}{"SUBSCRIBE", "channel"}, true},
+		{CmdMulti, []interface{}{"MULTI"}, true},
+		{CmdSelect, []interface{}{"SELECT", 1}, true},
+		{CmdDo, []interface{}{"monitor"}, true},
+		{CmdDo, []interface{}{"set", "key", "value"}, false},
+	}
+	for _, test := range tests {
+		if connState := isConnState(test.name, test.cmd); connState != test.connState {
+			t.Fatalf("%v: got: %t expected: %t", test.cmd, connState, test.connState)
+		}
+	}
+}
+
+func TestMultiplexDB(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	var mu sync.Mutex
+	setConns := make(map[net.Conn]int)
+	var slowConn net.Conn
+	blpop, slow := make(chan struct{}), make(chan struct{})
+
+	s.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		switch strings.ToUpper(cmd[0]) {
+		case "BLPOP":
+			<-blpop
+			w.WriteString("*2\r\n$4\r\nlist\r\n$5\r\nvalue\r\n")
+		case "GET":
+			if cmd[1] != "slow" {
+				return false
+			}
+			mu.Lock()
+			slowConn = c
+			mu.Unlock()
+			<-slow
+			w.WriteString("$-1\r\n")
+		case "SET":
+			mu.Lock()
+			setConns[c]++
+			mu.Unlock()
+			return false
+		default:
+			return false
+		}
+		return true
+	}
+
+	t.Run("Dedicated", func(t *testing.T) {
+		db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{MultiplexConns: 2})
+		defer db.Close()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := fmt.Sprintf("key%d", i)
+				if err := db.Set(key, i).Err(); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		blpopResult := db.Blpop([]interface{}{"list"}, 0)
+		if err := db.Get("key1").Err(); err != nil { // not blocked by BLPOP
+			t.Fatal(err)
+		}
+		if stats := db.Stats(); stats.SharedConnections != 2 || stats.InUse != 1 {
+			t.Fatalf("got: shared %d in use %d expected: shared 2 in use 1", stats.SharedConnections, stats.InUse)
+		}
+
+		close(blpop)
+		if _, err := blpopResult.ToStringSlice(); err != nil {
+			t.Fatal(err)
+		}
+		// dedicated connection is released after the result is available
+		deadline := time.Now().Add(time.Second)
+		for db.Stats().Idle != 1 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if stats := db.Stats(); stats.InUse != 0 || stats.Idle != 1 {
+			t.Fatalf("got: in use %d idle %d expected: in use 0 idle 1", stats.InUse, stats.Idle)
+		}
+
+		// connection state changing commands are rejected
+		n := s.countCmds("SUBSCRIBE")
+		if err := db.Subscribe([]string{"channel"}, func(pattern, channel, msg string) {}).Err(); err != ErrConnStateCommand {
+			t.Fatalf("got: %v expected: %v", err, ErrConnStateCommand)
+		}
+		if err := db.Do("select", 1).Err(); err != ErrConnStateCommand {
+			t.Fatalf("got: %v expected: %v", err, ErrConnStateCommand)
+		}
+		if m := s.countCmds("SUBSCRIBE"); m != n {
+			t.Fatalf("got: %d expected: %d SUBSCRIBE commands", m, n)
+		}
+		if stats := db.Stats(); stats.InUse != 0 || stats.Idle != 1 || stats.OpenConnections != 1 {
+			t.Fatalf("got: in use %d idle %d open %d expected: in use 0 idle 1 open 1", stats.InUse, stats.Idle, stats.OpenConnections)
+		}
+
+		db.Close()
+		if err := db.Get("key1").Err(); err != ErrDBClosed {
+			t.Fatalf("got: %v expected: %v", err, ErrDBClosed)
+		}
+	})
+
+	t.Run("LeastInflight", func(t *testing.T) {
+		db := OpenDBWithOptions(s.addr(), Dialer{}, DBOptions{MultiplexConns: 2, Balance: BalanceLeastInflight})
+		defer db.Close()
+
+		mu.Lock()
+		setConns = make(map[net.Conn]int)
+		mu.Unlock()
+
+		slowResult := db.Get("slow")
+		for i := 0; i < 5; i++ {
+			if err := db.Set("key", i).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(slow)
+		if err := slowResult.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(setConns) != 1 || setConns[slowConn] != 0 {
+			t.Fatal("commands not sent on the connection with least inflight commands")
+		}
+	})
+}
@@ -16,25 +16,32 @@ limitations under the License.
 
 package client
 
-import (
-	"log"
-)
-
-// GenericNotification represents the type for an out of bound push notification send by Redis.
+// GenericNotification represents the type for an out of bound push notification send by Redis not handled by the client.
 type genericNotification struct {
 	kind   string
 	values []RedisValue
 }
 
+// subscriptionKind defines whether a subscription is a channel, a pattern or a shard channel subscription.
+type subscriptionKind int
+
+const (
+	subscriptionChannel subscriptionKind = iota
+	subscriptionPattern
+	subscriptionShard
+)
+
 // SubscribeNotification represents the type for an out of bound subscribe push notification send by Redis.
 type subscribeNotification struct {
-	channel string // channel or pattern
+	channel string // channel, pattern or shard channel
+	kind    subscriptionKind
 	count   int64
 }
 
 // UnsubscribeNotification represents the type for an out of bound unsubscribe push notification send by Redis.
 type unsubscribeNotification struct {
-	channel string
+	channel string // channel, pattern or shard channel
+	kind    subscriptionKind
 	count   int64
 }
 
@@ -43,11 +50,24 @@ type publishNotification struct {
 	pattern string
 	channel string
 	msg     string
+	shard   bool
+}
+
+// subscription returns the kind and the pattern or channel the message was subscribed with.
+func (n *publishNotification) subscription() (subscriptionKind, string) {
+	switch {
+	case n.pattern != "":
+		return subscriptionPattern, n.pattern
+	case n.shard:
+		return subscriptionShard, n.channel
+	default:
+		return subscriptionChannel, n.channel
+	}
 }
 
 // InvalidateNotification represents the type for an out of bound invalidation push notification send by Redis (client side caching).
 type invalidateNotification struct {
-	keys []string // keys to invalidate
+	keys []string // keys to invalidate - nil: invalidate all keys
 }
 
 //
@@ -56,50 +76,113 @@ const (
 	pubSubUnsubscribe  = "unsubscribe"
 	pubSubPsubscribe   = "psubscribe"
 	pubSubPunsubscribe = "punsubscribe"
+	pubSubSsubscribe   = "ssubscribe"
+	pubSubSunsubscribe = "sunsubscribe"
 	pubSubMessage      = "message"
 	pubSubPMessage     = "pmessage"
+	pubSubSMessage     = "smessage"
 	invalidateMessage  = "invalidate"
+	redirBrokenMessage = "tracking-redir-broken"
 )
 
-func assertNotification(condition bool, v []RedisValue) {
-	if !condition {
-		log.Panicf("invalid notification %v", v)
+func notificationKind(kind string) subscriptionKind {
+	switch kind {
+	case pubSubPsubscribe, pubSubPunsubscribe:
+		return subscriptionPattern
+	case pubSubSsubscribe, pubSubSunsubscribe:
+		return subscriptionShard
+	default:
+		return subscriptionChannel
 	}
 }
 
-//
-func newNotification(v []RedisValue) (interface{}, error) {
-	assertNotification(len(v) > 0 && v[0].Kind() == RkString, v)
+// unsubscribeKind returns the subscription kind of an unsubscribe command.
+func unsubscribeKind(cmd []interface{}) (subscriptionKind, bool) {
+	switch cmdToken(cmd, 0) {
+	case "UNSUBSCRIBE":
+		return subscriptionChannel, true
+	case "PUNSUBSCRIBE":
+		return subscriptionPattern, true
+	case "SUNSUBSCRIBE":
+		return subscriptionShard, true
+	default:
+		return 0, false
+	}
+}
 
-	kind := string(v[0].(_string))
+func invalidNotification(v []RedisValue) error {
+	return newProtocolError("invalid notification %v", v)
+}
 
-	switch kind {
+// newNotification returns the notification of push value v.
+// In case v is not a valid notification a ProtocolError is returned.
+func newNotification(v []RedisValue) (interface{}, error) {
+	if len(v) == 0 {
+		return nil, invalidNotification(v)
+	}
+	kind, ok := v[0].(_string)
+	if !ok {
+		return nil, invalidNotification(v)
+	}
 
-	case pubSubSubscribe, pubSubPsubscribe:
-		assertNotification(len(v) == 3 && v[1].Kind() == RkString && v[2].Kind() == RkNumber, v)
-		return &subscribeNotification{channel: string(v[1].(_string)), count: int64(v[2].(_number))}, nil
+	switch kind := string(kind); kind {
 
-	case pubSubUnsubscribe, pubSubPunsubscribe:
-		assertNotification(len(v) == 3 && v[1].Kind() == RkString && v[2].Kind() == RkNumber, v)
-		return &unsubscribeNotification{channel: string(v[1].(_string)), count: int64(v[2].(_number))}, nil
+	case pubSubSubscribe, pubSubPsubscribe, pubSubSsubscribe:
+		if len(v) == 3 {
+			channel, ok1 := v[1].(_string)
+			count, ok2 := v[2].(_number)
+			if ok1 && ok2 {
+				return &subscribeNotification{channel: string(channel), kind: notificationKind(kind), count: int64(count)}, nil
+			}
+		}
+
+	case pubSubUnsubscribe, pubSubPunsubscribe, pubSubSunsubscribe:
+		// channel is null in case of unsubscribing all channels without any subscription
+		if len(v) == 3 {
+			channel, ok1 := v[1].(_string)
+			count, ok2 := v[2].(_number)
+			if (ok1 || v[1].Kind() == RkNull) && ok2 {
+				return &unsubscribeNotification{channel: string(channel), kind: notificationKind(kind), count: int64(count)}, nil
+			}
+		}
 
-	case pubSubMessage:
-		assertNotification(len(v) == 3 && v[1].Kind() == RkString && v[2].Kind() == RkString, v)
-		return &publishNotification{channel: string(v[1].(_string)), msg: string(v[2].(_string))}, nil
+	case pubSubMessage, pubSubSMessage:
+		if len(v) == 3 {
+			channel, ok1 := v[1].(_string)
+			msg, ok2 := v[2].(_string)
+			if ok1 && ok2 {
+				return &publishNotification{channel: string(channel), msg: string(msg), shard: kind == pubSubSMessage}, nil
+			}
+		}
 
 	case pubSubPMessage:
-		assertNotification(len(v) == 4 && v[1].Kind() == RkString && v[2].Kind() == RkString && v[3].Kind() == RkString, v)
-		return &publishNotification{channel: string(v[1].(_string)), pattern: string(v[2].(_string)), msg: string(v[3].(_string))}, nil
+		if len(v) == 4 {
+			pattern, ok1 := v[1].(_string)
+			channel, ok2 := v[2].(_string)
+			msg, ok3 := v[3].(_string)
+			if ok1 && ok2 && ok3 {
+				return &publishNotification{pattern: string(pattern), channel: string(channel), msg: string(msg)}, nil
+			}
+		}
 
 	case invalidateMessage:
-		assertNotification(len(v) == 2 && v[1].Kind() == RkSlice, v)
-		keys, err := v[1].ToStringSlice()
-		if err != nil {
-			return nil, err
+		if len(v) == 2 {
+			switch v[1].Kind() {
+			case RkNull: // flush
+				return &invalidateNotification{}, nil
+			case RkSlice:
+				if keys, err := v[1].ToStringSlice(); err == nil {
+					return &invalidateNotification{keys: keys}, nil
+				}
+			}
 		}
-		return &invalidateNotification{keys: keys}, nil
+
+	case redirBrokenMessage: // tracking information lost
+		return &invalidateNotification{}, nil
 
 	default:
 		return &genericNotification{kind: kind, values: v[1:]}, nil
 	}
+
+	return nil, invalidNotification(v)
 }
@@ -0,0 +1,61 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPushCallback(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	type push struct {
+		kind   string
+		values []RedisValue
+	}
+	pushs := make(chan push, 1)
+
+	d := &Dialer{PushCallback: func(kind string, values []RedisValue) { pushs <- push{kind, values} }}
+	c, err := d.Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s.push(">3\r\n$6\r\nmodule\r\n$5\r\nevent\r\n:42\r\n")
+
+	select {
+	case p := <-pushs:
+		expected := push{"module", []RedisValue{_string("event"), _number(42)}}
+		if !reflect.DeepEqual(p, expected) {
+			t.Fatalf("got: %v expected: %v", p, expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("push notification not received")
+	}
+
+	// push notification must not interfere with command results
+	if err := c.Set("key", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get("key").ToString(); err != nil || v != "value" {
+		t.Fatalf("got: %s %v expected: %s", v, err, "value")
+	}
+}
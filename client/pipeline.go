@@ -17,6 +17,7 @@ limitations under the License.
 package client
 
 import (
+	"context"
 	"sync/atomic"
 )
 
@@ -24,6 +25,9 @@ import (
 // Multiple goroutines must not invoke methods on a Pipeline simultaneously.
 type Pipeline interface {
 	Commands
+	// WithContext returns the pipeline commands bound to ctx.
+	// Waiting for a command result is stopped when ctx is done.
+	WithContext(ctx context.Context) Commands
 	Reset()
 	Flush() error
 }
@@ -51,6 +55,10 @@ func (p *pipeline) send(name string, r *result) {
 	p.results = append(p.results, r)
 }
 
+func (p *pipeline) WithContext(ctx context.Context) Commands {
+	return newCommand(contextSend(ctx, p.send), p.c.sendInterceptor)
+}
+
 func (p *pipeline) Reset() {
 	p.results = p.results[:0]
 }
@@ -18,18 +18,22 @@ package client
 
 import (
 	"bufio"
+	"encoding"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/big"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/stfnmllr/go-resp3/client/internal/conv"
 	"github.com/stfnmllr/go-resp3/client/internal/monitor"
 )
 
 const (
-	protocolVersion = 3
+	protocolVersion      = 3
+	protocolVersionRESP2 = 2
 )
 
 // Redis reply constants.
@@ -69,6 +73,17 @@ const (
 
 const maxInt = int64(^uint(0) >> 1)
 
+// Decoding limits protecting against invalid data.
+const (
+	// blobChunkSize is the size by which the read buffer grows while reading large blobs,
+	// so that an invalid blob size does not allocate memory before the data is received.
+	blobChunkSize = 1 << 20
+	// maxPrealloc is the maximum number of aggregate elements allocated before the elements are received.
+	maxPrealloc = 1024
+	// maxNestingDepth is the maximum nesting depth of aggregate values.
+	maxNestingDepth = 512
+)
+
 // A InvalidValueError is raised by a redis commend
 // provided with an invalid parameter value.
 // - Name:  Parameter name.
@@ -96,6 +111,22 @@ func (e *InvalidTypeError) Error() string {
 	return fmt.Sprintf("encode: unsupported type %[1]T value %[1]v", e.Value)
 }
 
+// A ProtocolError is returned in case data received from Redis violates the
+// RESP3 protocol or does not match the sent commands (e.g. by a misbehaving proxy).
+// As the replies cannot be assigned to commands anymore, the connection is closed
+// and all pending results fail with the protocol error.
+type ProtocolError struct {
+	Msg string
+}
+
+func newProtocolError(format string, v ...interface{}) *ProtocolError {
+	return &ProtocolError{Msg: fmt.Sprintf(format, v...)}
+}
+
+func (e *ProtocolError) Error() string {
+	return "protocol error: " + e.Msg
+}
+
 // An UnexpectedCharacterError is raised by decoding
 // an unexpected character.
 type UnexpectedCharacterError struct {
@@ -151,12 +182,30 @@ func Int64Ptr(i int64) *int64 {
 var _ Encoder = (*encode)(nil)
 var _ Decoder = (*decode)(nil)
 
+// Valuer is the interface implemented by types that can convert themselves
+// to a command argument (e.g. domain types like UUIDs).
+// The returned value is encoded like any other command argument.
+type Valuer interface {
+	Value() (interface{}, error)
+}
+
 // Encoder is the interface that wraps the Encode method.
 //
 // Encode is not a general redis encoder but encodes redis commands only.
 // Redis commands are send as ARRAY of BULK STRINGS.
 // Encode is encoding all elements of v to BULK STRINGS.
-// In case an element is a not suported type, Encode will panic.
+//
+// Supported element types are
+// - string, []byte, bool, integer and float types (including types based on them),
+// - time.Time (RFC 3339 formatted), time.Duration and *big.Int,
+// - types implementing Valuer, encoding.TextMarshaler or encoding.BinaryMarshaler
+//   (in this order of precedence, so that e.g. UUIDs are encoded as readable text) and
+// - pointers to supported types.
+// A time.Duration is encoded as integer number of milliseconds and is therefore only suitable for
+// millisecond based arguments (e.g. PEXPIRE, SET PX). Durations with sub-millisecond precision are rejected
+// by an InvalidValueError. Seconds based arguments (e.g. EXPIRE, BLPOP timeout) need to be provided as number of seconds.
+// In case an element is not a supported type, Encode returns an InvalidTypeError and the command is not written.
+// In case reading a BulkReader fails, the command is written partially and Flush returns the read error.
 type Encoder interface {
 	Encode([]interface{}) error
 	Flush() error
@@ -168,8 +217,9 @@ func NewEncoder(w io.Writer) Encoder {
 }
 
 type encode struct {
-	w   *bufio.Writer
-	err error
+	w    *bufio.Writer
+	args []string // converted arguments of the command being encoded
+	err  error
 }
 
 func newEncode(w io.Writer) *encode {
@@ -180,12 +230,39 @@ func newEncode(w io.Writer) *encode {
 }
 
 func (e *encode) Encode(values []interface{}) error {
+	// convert all arguments before writing, so that an invalid argument does not leave a partial command
+	defer e.resetArgs()
+	for _, v := range values {
+		var s string
+		var err error
+		switch v := v.(type) {
+		case BulkReader:
+			err = checkReader(&v)
+		case *BulkReader:
+			err = checkReader(v)
+		default:
+			s, err = argString(v)
+		}
+		if err != nil {
+			return err
+		}
+		e.args = append(e.args, s)
+	}
+
 	e.w.WriteByte(arrayType)
 	e.w.WriteString(strconv.Itoa(len(values)))
 	e.w.WriteString(lineBreak)
-	for _, v := range values {
-		err := e.encode(v)
-		if err != nil {
+	for i, v := range values {
+		var err error
+		switch v := v.(type) {
+		case BulkReader:
+			err = e.encodeReader(v)
+		case *BulkReader:
+			err = e.encodeReader(*v)
+		default:
+			e.encodeString(e.args[i])
+		}
+		if err != nil { // command is written partially
 			e.err = err
 			return err
 		}
@@ -193,6 +270,14 @@ func (e *encode) Encode(values []interface{}) error {
 	return nil
 }
 
+// resetArgs releases the converted arguments.
+func (e *encode) resetArgs() {
+	for i := range e.args {
+		e.args[i] = ""
+	}
+	e.args = e.args[:0]
+}
+
 func (e *encode) Flush() error {
 	if e.err != nil {
 		return e.err
@@ -201,52 +286,136 @@ func (e *encode) Flush() error {
 	return e.w.Flush()
 }
 
-func (e *encode) encode(v interface{}) error {
+// argString returns the string representation of a command argument.
+func argString(v interface{}) (string, error) {
 	switch v := v.(type) {
 	case string:
-		e.encodeString(v)
+		return v, nil
 	case []byte:
-		e.encodeString(string(v))
+		return string(v), nil
 	case bool:
-		e.encodeString(strconv.FormatBool(v))
+		return strconv.FormatBool(v), nil
 	case int:
-		e.encodeString(strconv.FormatInt(int64(v), 10))
+		return strconv.FormatInt(int64(v), 10), nil
 	case uint:
-		e.encodeString(strconv.FormatUint(uint64(v), 10))
+		return strconv.FormatUint(uint64(v), 10), nil
 	case float32:
-		e.encodeString(strconv.FormatFloat(float64(v), 'g', -1, 64))
+		return strconv.FormatFloat(float64(v), 'g', -1, 64), nil
 	case float64:
-		e.encodeString(strconv.FormatFloat(v, 'g', -1, 64))
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
 	case Zfloat64:
-		e.encodeString(v.String())
-	default:
-		return e.encodeValue(reflect.ValueOf(v))
+		return v.String(), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case *time.Time: // do not use binary marshaler
+		if v == nil {
+			return "", &InvalidTypeError{v}
+		}
+		return v.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		if v%time.Millisecond != 0 { // do not truncate silently
+			return "", newInvalidValueError("time.Duration", v)
+		}
+		return strconv.FormatInt(int64(v/time.Millisecond), 10), nil
+	case *big.Int:
+		if v == nil {
+			return "", &InvalidTypeError{v}
+		}
+		return v.String(), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return "", &InvalidTypeError{v}
 	}
-	return nil
-}
 
-func (e *encode) encodeValue(v reflect.Value) error {
-	switch v.Kind() {
+	switch v := v.(type) {
+	case Valuer:
+		x, err := v.Value()
+		if err != nil {
+			return "", err
+		}
+		return argString(x)
+	case encoding.TextMarshaler:
+		b, err := v.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	switch rv.Kind() {
 	case reflect.String:
-		e.encodeString(v.String())
+		return rv.String(), nil
 	case reflect.Bool:
-		e.encodeString(strconv.FormatBool(v.Bool()))
+		return strconv.FormatBool(rv.Bool()), nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		e.encodeString(strconv.FormatInt(v.Int(), 10))
+		return strconv.FormatInt(rv.Int(), 10), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		e.encodeString(strconv.FormatUint(v.Uint(), 10))
+		return strconv.FormatUint(rv.Uint(), 10), nil
 	case reflect.Float32, reflect.Float64:
-		e.encodeString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
-	case reflect.Interface:
-		e.encodeValue(v.Elem())
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 64), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), nil
+		}
 	case reflect.Ptr:
-		e.encodeValue(v.Elem())
-	default:
-		return &InvalidTypeError{v}
+		return argString(rv.Elem().Interface())
+	}
+	return "", &InvalidTypeError{v}
+}
+
+// checkArgs checks if the command arguments values can be encoded.
+func checkArgs(values []interface{}) error {
+	for _, v := range values {
+		var err error
+		switch v := v.(type) {
+		case BulkReader:
+			err = checkReader(&v)
+		case *BulkReader:
+			err = checkReader(v)
+		default:
+			_, err = argString(v)
+		}
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// checkReader checks the BulkReader argument br.
+func checkReader(br *BulkReader) error {
+	if br == nil {
+		return newInvalidValueError("BulkReader", br)
+	}
+	if br.R == nil || br.Size < 0 {
+		return newInvalidValueError("BulkReader", *br)
+	}
+	return nil
+}
+
+// encodeReader streams the bulk string read from br.R.
+func (e *encode) encodeReader(br BulkReader) error {
+	e.w.WriteByte(blobStringType)
+	e.w.WriteString(strconv.FormatInt(br.Size, 10))
+	e.w.WriteString(lineBreak)
+	if _, err := io.CopyN(e.w, br.R, br.Size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	e.w.WriteString(lineBreak)
+	return nil
+}
+
 func (e *encode) encodeString(s string) {
 	e.w.WriteByte(blobStringType)
 	e.w.WriteString(strconv.Itoa(len(s)))
@@ -308,11 +477,7 @@ func (r *decodeReader) readByte() (byte, error) {
 	return b[0], nil
 }
 
-func (r *decodeReader) resize(size64 int64) {
-	if size64 > maxInt {
-		panic("maximum integer size exceeded")
-	}
-	size := int(size64)
+func (r *decodeReader) resize(size int) {
 	if cap(r.buf) < size {
 		r.buf = make([]byte, size)
 	}
@@ -320,9 +485,21 @@ func (r *decodeReader) resize(size64 int64) {
 }
 
 func (r *decodeReader) readBlob(size int64) ([]byte, error) {
-	r.resize(size + 2)
-	if _, err := io.ReadFull(r.r, r.buf); err != nil {
-		return nil, err
+	if size < 0 || size > maxInt-2 {
+		return nil, newProtocolError("invalid blob size %d", size)
+	}
+	n := int(size) + 2
+	r.buf = r.buf[:0]
+	for len(r.buf) < n { // grow buffer while receiving data
+		l := len(r.buf)
+		chunk := n - l
+		if chunk > blobChunkSize {
+			chunk = blobChunkSize
+		}
+		r.buf = append(r.buf, make([]byte, chunk)...)
+		if _, err := io.ReadFull(r.r, r.buf[l:]); err != nil {
+			return nil, err
+		}
 	}
 	if r.buf[size] != lf {
 		return nil, &UnexpectedCharacterError{ActChar: r.buf[size], ExpChar: lf}
@@ -333,6 +510,34 @@ func (r *decodeReader) readBlob(size int64) ([]byte, error) {
 	return r.buf[:size], nil
 }
 
+// copyBlob writes the blob of size to w in chunks.
+// In case w returns an error the rest of the blob is read and discarded
+// to keep the reader in sync and the write error is returned as werr.
+func (r *decodeReader) copyBlob(w io.Writer, size int64) (n int64, werr, err error) {
+	const chunkSize = 32768
+
+	for size > 0 {
+		chunk := size
+		if chunk > chunkSize {
+			chunk = chunkSize
+		}
+		r.resize(int(chunk))
+		if _, err := io.ReadFull(r.r, r.buf); err != nil {
+			return n, werr, err
+		}
+		if werr == nil {
+			var m int
+			m, werr = w.Write(r.buf)
+			n += int64(m)
+			if werr == nil && m != len(r.buf) {
+				werr = io.ErrShortWrite
+			}
+		}
+		size -= chunk
+	}
+	return n, werr, r.readLineBreak()
+}
+
 // replace bufio.Reader readBytes, readString as they do allocate
 func (r *decodeReader) readDelim(delim byte) ([]byte, error) {
 	r.buf = r.buf[:0]
@@ -373,18 +578,39 @@ func (r *decodeReader) readFixedSize() (int64, error) {
 	return i, nil
 }
 
+// Sizes returned by readSize and readNullableSize.
+const (
+	streamedSize = -1 // streamed string or aggregate
+	nullSize     = -2 // RESP2 null bulk string or null array
+)
+
 func (r *decodeReader) readSize() (int64, error) {
+	size, err := r.readNullableSize()
+	if err == nil && size == nullSize {
+		return 0, newProtocolError("invalid size -1")
+	}
+	return size, err
+}
+
+// readNullableSize reads a size allowing the RESP2 null size -1, which is returned as nullSize.
+func (r *decodeReader) readNullableSize() (int64, error) {
 	b, err := r.readBytes()
 	if err != nil {
 		return 0, err
 	}
 	if len(b) == 1 && b[0] == streamedType {
-		return -1, nil
+		return streamedSize, nil
 	}
 	size, err := conv.ParseInt(b)
 	if err != nil {
 		return 0, &InvalidNumberError{Value: string(b)}
 	}
+	switch {
+	case size == -1:
+		return nullSize, nil
+	case size < 0:
+		return 0, newProtocolError("invalid size %d", size)
+	}
 	return size, nil
 }
 
@@ -395,15 +621,26 @@ type Decoder interface {
 
 // NewDecoder returns a Decoder for Redis results.
 func NewDecoder(r io.Reader) Decoder {
+	return newDecode(r, false)
+}
+
+func newDecode(r io.Reader, useArena bool) *decode {
 	return &decode{
-		r:   newDecodeReader(r),
-		buf: make([]byte, 0, 128),
+		r:        newDecodeReader(r),
+		buf:      make([]byte, 0, 128),
+		useArena: useArena,
 	}
 }
 
 type decode struct {
 	r   *decodeReader
 	buf []byte
+
+	depth int // nesting depth of aggregate values
+
+	useArena bool        // decode aggregate replies into a reply arena
+	inArena  bool        // decoding a reply into arena
+	arena    *replyArena // arena of the reply being decoded - nil if not needed yet
 }
 
 func (d *decode) Decode() (interface{}, error) {
@@ -419,10 +656,73 @@ func (d *decode) Decode() (interface{}, error) {
 	case simpleStringType, blobStringType:
 		return d.decodeMonitorNotification() // can be dropped after monitor notification is send as notification
 	default:
+		if d.useArena {
+			return d.decodeArena()
+		}
 		return d.decode()
 	}
 }
 
+// decodeArena decodes a reply allocating aggregate values from a reply arena.
+// Replies not including aggregate values are returned as is, otherwise an arenaReply is returned.
+func (d *decode) decodeArena() (interface{}, error) {
+	d.inArena = true
+	v, err := d.decode()
+	a := d.arena
+	d.inArena, d.arena = false, nil
+	if err != nil {
+		if a != nil {
+			a.release()
+		}
+		return nil, err
+	}
+	if a == nil {
+		return v, nil
+	}
+	return &arenaReply{value: v, arena: a}, nil
+}
+
+// makeSlice returns an empty slice with capacity size allocated from the reply arena if used.
+// Sizes exceeding maxPrealloc are not preallocated.
+func (d *decode) makeSlice(size int64) []RedisValue {
+	if size > maxPrealloc {
+		return make([]RedisValue, 0, maxPrealloc)
+	}
+	if !d.inArena {
+		return make([]RedisValue, 0, size)
+	}
+	if d.arena == nil {
+		d.arena = getArena()
+	}
+	return d.arena.slice(int(size))
+}
+
+// makeMap returns an empty map with capacity size allocated from the reply arena if used.
+// Sizes exceeding maxPrealloc are not preallocated.
+func (d *decode) makeMap(size int64) _map {
+	if size > maxPrealloc {
+		return make(_map, 0, maxPrealloc)
+	}
+	if !d.inArena {
+		return make(_map, 0, size)
+	}
+	if d.arena == nil {
+		d.arena = getArena()
+	}
+	return d.arena.mapItems(int(size))
+}
+
+// enter increments the nesting depth of aggregate values.
+func (d *decode) enter() error {
+	if d.depth >= maxNestingDepth {
+		return newProtocolError("maximum nesting depth %d exceeded", maxNestingDepth)
+	}
+	d.depth++
+	return nil
+}
+
+func (d *decode) leave() { d.depth-- }
+
 func (d *decode) decodeMonitorNotification() (interface{}, error) {
 	t, err := d.r.readType()
 	if err != nil {
@@ -434,12 +734,19 @@ func (d *decode) decodeMonitorNotification() (interface{}, error) {
 	case blobStringType:
 		return d.decodeBlobStringOrMonitor()
 	default:
-		panic("wring data type")
+		return nil, newProtocolError("unexpected type %q", t)
 	}
 }
 
 func (d *decode) decodeBlobStringOrMonitor() (interface{}, error) {
-	b, err := d.decodeBlobStringType()
+	size, err := d.r.readNullableSize()
+	if err != nil {
+		return nil, err
+	}
+	if size == nullSize {
+		return _Null, nil
+	}
+	b, err := d.decodeBlob(size)
 	if err != nil {
 		return nil, err
 	}
@@ -473,7 +780,7 @@ func (d *decode) decodeTopLevel() (interface{}, error) {
 	case simpleErrorType:
 		return d.decodeSimpleError()
 	default:
-		panic("wring data type")
+		return nil, newProtocolError("unexpected type %q", t)
 	}
 }
 
@@ -534,13 +841,17 @@ func (d *decode) decodeType() (RedisValue, error) {
 	case booleanType:
 		return d.decodeBoolean()
 	case arrayType:
-		return d.decodeSlice()
+		return d.decodeArray()
 	case mapType:
 		return d.decodeMap()
 	case setType:
 		return d.decodeSet()
+	case simpleErrorType: // error within aggregate value (e.g. EXEC reply)
+		return errorValue(d.decodeSimpleError())
+	case blobErrorType:
+		return errorValue(d.decodeBlobError())
 	default:
-		panic("unsupported redis type " + string(t))
+		return nil, newProtocolError("unsupported type %q", t)
 	}
 }
 
@@ -550,15 +861,14 @@ func (d *decode) decodeBlobStringType() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return d.decodeBlob(size)
+}
 
-	var b []byte
-
-	if size == -1 {
-		b, err = d.decodeStreamedString()
-	} else {
-		b, err = d.r.readBlob(size)
+func (d *decode) decodeBlob(size int64) ([]byte, error) {
+	if size == streamedSize {
+		return d.decodeStreamedString()
 	}
-	return b, err
+	return d.r.readBlob(size)
 }
 
 // Error
@@ -578,9 +888,24 @@ func (d *decode) decodeBlobError() (error, error) {
 	return newRedisError(string(b)), err
 }
 
+// errorValue returns the decoded error e as value of an aggregate type.
+func errorValue(e, err error) (RedisValue, error) {
+	if err != nil {
+		return nil, err
+	}
+	return _error{err: e.(*RedisError)}, nil
+}
+
 // String
 func (d *decode) decodeBlobString() (RedisValue, error) {
-	b, err := d.decodeBlobStringType()
+	size, err := d.r.readNullableSize()
+	if err != nil {
+		return nil, err
+	}
+	if size == nullSize { // RESP2
+		return _Null, nil
+	}
+	b, err := d.decodeBlob(size)
 	if err != nil {
 		return nil, err
 	}
@@ -624,6 +949,56 @@ func (d *decode) decodeStreamedString() ([]byte, error) {
 	return d.buf, nil
 }
 
+func (d *decode) peek() (byte, error) { return d.r.peek() }
+
+// decodeBlobTo writes a blob string - streamed or not - to w without materializing the value.
+// In case w returns an error the blob is discarded and the write error is returned as werr.
+// For the RESP2 null bulk string n is -1.
+func (d *decode) decodeBlobTo(w io.Writer) (n int64, werr, err error) {
+	if err := d.r.discardByte(blobStringType); err != nil {
+		return 0, nil, err
+	}
+	size, err := d.r.readNullableSize()
+	if err != nil {
+		return 0, nil, err
+	}
+	switch size {
+	case nullSize:
+		return -1, nil, nil
+	case streamedSize:
+	default:
+		return d.r.copyBlob(w, size)
+	}
+
+	for {
+		if err := d.r.discardByte(streamedStringToken); err != nil {
+			return n, werr, err
+		}
+		l, err := d.r.readFixedSize()
+		if err != nil {
+			return n, werr, err
+		}
+		if l < 0 {
+			return n, werr, newProtocolError("invalid streamed string chunk size %d", l)
+		}
+		if l == 0 {
+			return n, werr, nil
+		}
+		dst := w
+		if werr != nil { // discard remaining chunks
+			dst = ioutil.Discard
+		}
+		m, cerr, err := d.r.copyBlob(dst, l)
+		if werr == nil {
+			n += m
+			werr = cerr
+		}
+		if err != nil {
+			return n, werr, err
+		}
+	}
+}
+
 func (d *decode) decodeSimpleString() (RedisValue, error) {
 	b, err := d.r.readBytes()
 	if err != nil {
@@ -670,7 +1045,14 @@ func (d *decode) decodeBoolean() (RedisValue, error) {
 	if err != nil {
 		return nil, err
 	}
-	return _boolean(b == booleanTrue), nil
+	switch b {
+	case booleanTrue:
+		return _boolean(true), nil
+	case booleanFalse:
+		return _boolean(false), nil
+	default:
+		return nil, newProtocolError("invalid boolean %q", b)
+	}
 }
 
 // Push Notification
@@ -682,16 +1064,43 @@ func (d *decode) decodePushSlice() (interface{}, error) {
 	return newNotification(slice)
 }
 
+// decodeArray decodes an array reply including the RESP2 null array.
+func (d *decode) decodeArray() (RedisValue, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
+	size, err := d.r.readNullableSize()
+	if err != nil {
+		return nil, err
+	}
+
+	switch size {
+	case nullSize: // RESP2
+		return _Null, nil
+	case streamedSize:
+		return d.decodeStreamedSlice()
+	default:
+		return d.decodeFixedSlice(size)
+	}
+}
+
 // Slice
 func (d *decode) decodeSlice() (_slice, error) {
 	var v _slice
 
+	if err := d.enter(); err != nil {
+		return v, err
+	}
+	defer d.leave()
+
 	size, err := d.r.readSize()
 	if err != nil {
 		return v, err
 	}
 
-	if size == -1 {
+	if size == streamedSize {
 		v, err = d.decodeStreamedSlice()
 	} else {
 		v, err = d.decodeFixedSlice(size)
@@ -700,13 +1109,13 @@ func (d *decode) decodeSlice() (_slice, error) {
 }
 
 func (d *decode) decodeFixedSlice(size int64) (_slice, error) {
-	s := make(_slice, size)
+	s := _slice(d.makeSlice(size))
 	for i := int64(0); i < size; i++ {
 		val, err := d.decode()
 		if err != nil {
 			return s, err
 		}
-		s[i] = val
+		s = append(s, val)
 	}
 	return s, nil
 }
@@ -737,12 +1146,17 @@ func (d *decode) decodeStreamedSlice() (_slice, error) {
 func (d *decode) decodeMap() (_map, error) {
 	var v _map
 
+	if err := d.enter(); err != nil {
+		return v, err
+	}
+	defer d.leave()
+
 	size, err := d.r.readSize()
 	if err != nil {
 		return v, err
 	}
 
-	if size == -1 {
+	if size == streamedSize {
 		v, err = d.decodeStreamedMap()
 	} else {
 		v, err = d.decodeFixedMap(size)
@@ -751,7 +1165,7 @@ func (d *decode) decodeMap() (_map, error) {
 }
 
 func (d *decode) decodeFixedMap(size int64) (_map, error) {
-	m := make(_map, size)
+	m := d.makeMap(size)
 	for i := int64(0); i < size; i++ {
 		key, err := d.decode()
 		if err != nil {
@@ -761,7 +1175,7 @@ func (d *decode) decodeFixedMap(size int64) (_map, error) {
 		if err != nil {
 			return m, err
 		}
-		m[i] = MapItem{key, val}
+		m = append(m, MapItem{key, val})
 	}
 	return m, nil
 }
@@ -796,12 +1210,17 @@ func (d *decode) decodeStreamedMap() (_map, error) {
 func (d *decode) decodeSet() (_set, error) {
 	var v _set
 
+	if err := d.enter(); err != nil {
+		return v, err
+	}
+	defer d.leave()
+
 	size, err := d.r.readSize()
 	if err != nil {
 		return v, err
 	}
 
-	if size == -1 {
+	if size == streamedSize {
 		v, err = d.decodeStreamedSet()
 	} else {
 		v, err = d.decodeFixedSet(size)
@@ -810,13 +1229,13 @@ func (d *decode) decodeSet() (_set, error) {
 }
 
 func (d *decode) decodeFixedSet(size int64) (_set, error) {
-	s := make(_set, size)
+	s := _set(d.makeSlice(size))
 	for i := int64(0); i < size; i++ {
 		val, err := d.decode()
 		if err != nil {
 			return s, err
 		}
-		s[i] = val
+		s = append(s, val)
 	}
 	return s, nil
 }
@@ -19,12 +19,39 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"log"
 	"math"
 	"math/big"
+	"math/rand"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
+type testUUID [16]byte
+
+func (u testUUID) Value() (interface{}, error) { return hex.EncodeToString(u[:]), nil }
+
+type testBinary struct{ b []byte }
+
+func (b *testBinary) MarshalBinary() ([]byte, error) {
+	if b.b == nil {
+		return nil, errors.New("empty")
+	}
+	return b.b, nil
+}
+
+// testTextBinary implements both, encoding.TextMarshaler and encoding.BinaryMarshaler.
+type testTextBinary [2]byte
+
+func (b testTextBinary) MarshalText() ([]byte, error)   { return []byte(hex.EncodeToString(b[:])), nil }
+func (b testTextBinary) MarshalBinary() ([]byte, error) { return b[:], nil }
+
 func TestProtocol(t *testing.T) {
 	var writeTest = []struct {
 		cmd []interface{}
@@ -32,6 +59,16 @@ func TestProtocol(t *testing.T) {
 	}{
 		{[]interface{}{1, 2, 3}, []byte("*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n")},
 		{[]interface{}{Int64Ptr(1), Int64Ptr(2), Int64Ptr(3)}, []byte("*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n")},
+		{[]interface{}{testUUID{0xab, 15: 0x01}}, []byte("*1\r\n$32\r\nab000000000000000000000000000001\r\n")},
+		{[]interface{}{&testBinary{[]byte{0, 1}}}, []byte("*1\r\n$2\r\n\x00\x01\r\n")},
+		{[]interface{}{net.IPv4(127, 0, 0, 1)}, []byte("*1\r\n$9\r\n127.0.0.1\r\n")}, // text marshaler before []byte
+		{[]interface{}{testTextBinary{0xab, 0x01}}, []byte("*1\r\n$4\r\nab01\r\n")},  // text marshaler before binary marshaler
+		{[]interface{}{"PEXPIRE", "key", 2 * time.Second}, []byte("*3\r\n$7\r\nPEXPIRE\r\n$3\r\nkey\r\n$4\r\n2000\r\n")},
+		{[]interface{}{"EXPIRE", "key", int64(2 * time.Second / time.Second)}, []byte("*3\r\n$6\r\nEXPIRE\r\n$3\r\nkey\r\n$1\r\n2\r\n")}, // seconds based
+		{[]interface{}{time.Date(2020, 6, 1, 12, 0, 0, 5, time.UTC)}, []byte("*1\r\n$30\r\n2020-06-01T12:00:00.000000005Z\r\n")},
+		{[]interface{}{&time.Time{}}, []byte("*1\r\n$20\r\n0001-01-01T00:00:00Z\r\n")},
+		{[]interface{}{1500 * time.Millisecond}, []byte("*1\r\n$4\r\n1500\r\n")},
+		{[]interface{}{big.NewInt(-42)}, []byte("*1\r\n$3\r\n-42\r\n")},
 	}
 
 	b := new(bytes.Buffer)
@@ -51,6 +88,31 @@ func TestProtocol(t *testing.T) {
 	}
 }
 
+func TestEncodeError(t *testing.T) {
+	for _, v := range []interface{}{nil, (*big.Int)(nil), (*testUUID)(nil), &testBinary{}, struct{}{}, []int{1}, 1500 * time.Microsecond, time.Nanosecond} {
+		if _, err := argString(v); err == nil {
+			t.Fatalf("value %#v: expected error", v)
+		}
+	}
+
+	b := new(bytes.Buffer)
+	enc := NewEncoder(b)
+	var typeErr *InvalidTypeError
+	if err := enc.Encode([]interface{}{"SET", "key", make(chan int)}); !errors.As(err, &typeErr) {
+		t.Fatalf("got: %v expected: %T", err, typeErr)
+	}
+	// invalid command is not written
+	if err := enc.Encode([]interface{}{"GET", "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"; b.String() != expected {
+		t.Fatalf("got: %q expected: %q", b.String(), expected)
+	}
+}
+
 func TestDecode(t *testing.T) {
 	const bigStr = "3492890328409238509324850943850943825024385"
 
@@ -68,6 +130,8 @@ func TestDecode(t *testing.T) {
 		{[]byte("$11\r\nHello World\r\n"), _string("Hello World")},                 // bulk string
 		{[]byte(":1234\r\n"), _number(1234)},                                       // number
 		{[]byte("_\r\n"), _null{}},                                                 // null
+		{[]byte("$-1\r\n"), _null{}},                                               // RESP2 null bulk string
+		{[]byte("*-1\r\n"), _null{}},                                               // RESP2 null array
 		{[]byte(",1.23\r\n"), _double(1.23)},                                       // double
 		{[]byte(",10\r\n"), _double(10)},                                           // double as integer
 		{[]byte(",inf\r\n"), _double(math.Inf(0))},                                 // double infinite
@@ -85,6 +149,10 @@ func TestDecode(t *testing.T) {
 			[]byte("*4\r\n+first\r\n:1\r\n+second\r\n:2\r\n"),
 			_slice{_string("first"), _number(1), _string("second"), _number(2)},
 		},
+		{ // slice including errors (e.g. EXEC reply)
+			[]byte("*3\r\n+OK\r\n-WRONGTYPE wrong kind of value\r\n!10\r\nERR failed\r\n"),
+			_slice{_string("OK"), _error{err: &RedisError{Code: "WRONGTYPE", Msg: "wrong kind of value"}}, _error{err: &RedisError{Code: "ERR", Msg: "failed"}}},
+		},
 		{ // streamed slice
 			[]byte("*?\r\n+a\r\n:1\r\n+b\r\n:2\r\n.\r\n"),
 			_slice{_string("a"), _number(1), _string("b"), _number(2)},
@@ -144,3 +212,181 @@ func TestDecode(t *testing.T) {
 		}
 	}
 }
+
+// decodeCorpus are malformed or unusual replies the decoder must reject or decode without panicking.
+var decodeCorpus = []string{
+	"",
+	"\r\n",
+	"x\r\n",                      // unknown type
+	"$-2\r\n",                    // negative size
+	"$-1\r\n",                    // RESP2 null
+	"*-1\r\n",                    // RESP2 null array
+	"$abc\r\n",                   // invalid size
+	"$9223372036854775807\r\n",   // huge size
+	"$99999999999999999999\r\n",  // size overflow
+	"*2147483647\r\n:1\r\n",      // huge array
+	"%2147483647\r\n",            // huge map
+	"~1000000000\r\n",            // huge set
+	"$5\r\nab",                   // truncated blob
+	"$2\r\nabcd\r\n",             // blob length mismatch
+	"$?\r\n;4\r\nab",             // truncated chunk
+	"$?\r\n;-3\r\nabc\r\n;0\r\n", // negative chunk size
+	"$?\r\n:1\r\n",               // invalid chunk
+	"*?\r\n:1\r\n",               // unterminated streamed array
+	"%?\r\n+a\r\n.\r\n",          // streamed map missing value
+	"#x\r\n",                     // invalid boolean
+	"#\r\n",
+	",abc\r\n", // invalid double
+	":12a\r\n", // invalid number
+	"(12a\r\n", // invalid big number
+	"=3\r\ntx\r\n",
+	"-\r\n", // empty error
+	"!3\r\nERR\r\n",
+	"|1\r\n+a\r\n",             // attribute without value
+	"|1\r\n+a\r\n:1\r\n|1\r\n", // nested attribute without value
+	">0\r\n",                   // empty push
+	">1\r\n:1\r\n",             // push kind no string
+	">2\r\n+message\r\n:1\r\n", // message missing values
+	">3\r\n+message\r\n*1\r\n:1\r\n:2\r\n",
+	">3\r\n+subscribe\r\n+ch\r\n+1\r\n", // count no number
+	">2\r\n+invalidate\r\n:1\r\n",       // invalid keys
+	">2\r\n+invalidate\r\n*1\r\n:1\r\n",
+	">4\r\n+pmessage\r\n+p\r\n+c\r\n",
+	"+1591619174.000000 [0 127.0.0.1:49326] \"keys\" \r\n", // monitor - trailing blank
+	"+1591619174.000000 [0 127.0.0.1:49326] \"k\r\n",       // monitor - unterminated string
+	"+1591619174.9 [0\r\n",                                 // monitor - truncated
+	"+1591619174.x [0 127.0.0.1:49326] \"\\x\"\r\n",        // monitor - invalid escape
+	strings.Repeat("*1\r\n", 2*maxNestingDepth) + ":1\r\n", // deep nesting
+	strings.Repeat("|1\r\n+a\r\n", 2*maxNestingDepth) + ":1\r\n",
+	strings.Repeat(">1\r\n", 2*maxNestingDepth) + ":1\r\n",
+}
+
+func TestDecodeNoPanic(t *testing.T) {
+	// valid replies mutated randomly (fixed seed for reproducibility)
+	valid := []string{
+		"*3\r\n$3\r\nfoo\r\n:1\r\n%1\r\n+k\r\n~1\r\n#t\r\n",
+		"$?\r\n;4\r\nHell\r\n;1\r\no\r\n;0\r\n",
+		"|1\r\n+ttl\r\n:3600\r\n*2\r\n,1.5\r\n(123\r\n",
+		">3\r\n+message\r\n+ch\r\n+msg\r\n",
+		">4\r\n+pmessage\r\n+p*\r\n+ch\r\n+msg\r\n",
+		">3\r\n+subscribe\r\n+ch\r\n:1\r\n",
+		">2\r\n+invalidate\r\n*1\r\n$3\r\nkey\r\n",
+		"+1591619174.123456 [0 127.0.0.1:49326] \"set\" \"k\" \"\\x41\\\"\"\r\n",
+	}
+	rnd := rand.New(rand.NewSource(1))
+	corpus := append([]string(nil), decodeCorpus...)
+	const mutationTypes = "$*%~|>#,:(=!-+_;.?0-\r\n"
+	for i := 0; i < 2000; i++ {
+		b := []byte(valid[rnd.Intn(len(valid))])
+		for j := rnd.Intn(3) + 1; j > 0; j-- {
+			pos := rnd.Intn(len(b))
+			switch rnd.Intn(3) {
+			case 0: // replace
+				b[pos] = mutationTypes[rnd.Intn(len(mutationTypes))]
+			case 1: // truncate
+				b = b[:pos]
+			default: // insert
+				b = append(b[:pos], append([]byte{mutationTypes[rnd.Intn(len(mutationTypes))]}, b[pos:]...)...)
+			}
+			if len(b) == 0 {
+				break
+			}
+		}
+		corpus = append(corpus, string(b))
+	}
+
+	decodeAll := func(dec Decoder) {
+		for i := 0; i < 1000; i++ { // values decoded without consuming input would loop
+			v, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			if reply, ok := v.(*arenaReply); ok {
+				reply.arena.release()
+			}
+		}
+	}
+
+	for i, s := range corpus {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("line: %d input: %q panic: %v", i, s, r)
+				}
+			}()
+			decodeAll(NewDecoder(strings.NewReader(s)))
+			decodeAll(newDecode(strings.NewReader(s), true))
+			newDecode(strings.NewReader(s), false).decodeBlobTo(ioutil.Discard)
+		}()
+	}
+}
+
+func TestDecodeProtocolError(t *testing.T) {
+	for _, s := range []string{"x\r\n", "$-2\r\n", "#x\r\n", strings.Repeat("*1\r\n", 2*maxNestingDepth) + ":1\r\n"} {
+		_, err := NewDecoder(strings.NewReader(s)).Decode()
+		var pErr *ProtocolError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("input: %q got: %v expected: protocol error", s, err)
+		}
+	}
+}
+
+func TestConnProtocolError(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	s.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		switch {
+		case strings.ToUpper(cmd[0]) == "GET" && cmd[1] == "invalid":
+			w.WriteString("x\r\n")
+		case strings.ToUpper(cmd[0]) == "SUBSCRIBE" && cmd[1] == "mismatch":
+			w.WriteString(">3\r\n")
+			bulk(w, "subscribe")
+			bulk(w, "other")
+			w.WriteString(":1\r\n")
+		default:
+			return false
+		}
+		return true
+	}
+
+	testProtocolError := func(err error) {
+		t.Helper()
+		var pErr *ProtocolError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("got: %v expected: %T", err, pErr)
+		}
+	}
+
+	// invalid reply type detected by decoder: connection is closed
+	var logBuf bytes.Buffer
+	conn, err := (&Dialer{Logger: log.New(&logBuf, "", 0)}).Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := conn.Pipeline()
+	r1 := p.Get("invalid")
+	r2 := p.Get("key")
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	testProtocolError(r1.Err())
+	testProtocolError(r2.Err())
+	conn.Close()
+	if !strings.Contains(logBuf.String(), "protocol error") {
+		t.Fatalf("protocol error not logged: %s", logBuf.String())
+	}
+
+	// subscribe channel mismatch detected by handler: connection is reestablished
+	conn, err = (&Dialer{Reconnect: true, ReconnectBackoff: testBackoff(10 * time.Millisecond)}).Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	testProtocolError(conn.Subscribe([]string{"mismatch"}, nil).Err())
+
+	time.Sleep(100 * time.Millisecond)
+	if err := conn.Set("key", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backoff is the function type returning the duration to wait before reconnect attempt n (n >= 1).
+type Backoff func(n int) time.Duration
+
+// ExponentialBackoff returns a Backoff doubling the duration to wait with every attempt starting with min up to max.
+func ExponentialBackoff(min, max time.Duration) Backoff {
+	return func(n int) time.Duration {
+		d := min
+		for i := 1; i < n && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			return max
+		}
+		return d
+	}
+}
+
+// Default reconnect backoff durations.
+const (
+	DefaultBackoffMin = 100 * time.Millisecond
+	DefaultBackoffMax = 10 * time.Second
+)
+
+// DefaultBackoff is the default reconnect backoff policy.
+var DefaultBackoff = ExponentialBackoff(DefaultBackoffMin, DefaultBackoffMax)
+
+// A ConnLostError is returned by commands which were in flight when the connection got lost.
+// Commands sent after reconnecting are not affected.
+type ConnLostError struct {
+	Err error // network or protocol error
+}
+
+func (e *ConnLostError) Error() string { return "connection lost: " + e.Err.Error() }
+
+// Unwrap returns the network or protocol error.
+func (e *ConnLostError) Unwrap() error { return e.Err }
+
+// session records the connection state to be restored after reconnect.
+type session struct {
+	auth, name, db, tracking, readonly []interface{}
+}
+
+// cmds returns the commands restoring the connection state.
+func (s *session) cmds() [][]interface{} {
+	cmds := make([][]interface{}, 0, 5)
+	for _, cmd := range [][]interface{}{s.auth, s.name, s.db, s.tracking, s.readonly} {
+		if cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+func cmdToken(cmd []interface{}, i int) string {
+	if i >= len(cmd) {
+		return ""
+	}
+	switch v := cmd[i].(type) {
+	case string:
+		return strings.ToUpper(v)
+	case []byte:
+		return strings.ToUpper(string(v))
+	default:
+		return ""
+	}
+}
+
+func copyCmd(cmd []interface{}) []interface{} {
+	return append(make([]interface{}, 0, len(cmd)), cmd...)
+}
+
+// updateSession records connection state changing commands after successful execution (handler only).
+func (c *conn) updateSession(cmd []interface{}) {
+	switch cmdToken(cmd, 0) {
+	case "AUTH":
+		c.session.auth = copyCmd(cmd)
+	case "SELECT":
+		c.session.db = copyCmd(cmd)
+	case "READONLY":
+		c.session.readonly = copyCmd(cmd)
+	case "READWRITE":
+		c.session.readonly = nil
+	case "CLIENT":
+		switch cmdToken(cmd, 1) {
+		case "SETNAME":
+			c.session.name = copyCmd(cmd)
+		case "TRACKING":
+			if cmdToken(cmd, 2) == "ON" {
+				c.session.tracking = copyCmd(cmd)
+			} else {
+				c.session.tracking = nil
+			}
+		}
+	case "QUIT":
+		c.setClosing()
+	}
+}
+
+type subscription struct {
+	name string // channel, pattern or shard channel
+	kind subscriptionKind
+	cb   MsgCallback
+}
+
+// resetMarker is sent by the watcher through the read channel after the connection got lost.
+// The handler acknowledges all results in flight and provides the state to be restored.
+type resetMarker struct {
+	err  error
+	done chan struct{}
+	cmds [][]interface{}
+	subs []subscription
+}
+
+// handleReset is called by the handler on receiving a reset marker.
+func (c *conn) handleReset(m *resetMarker) {
+	for r := c.pendingResult(); r != nil; r = c.pendingResult() {
+		r.ack(nil, m.err)
+	}
+	atomic.StoreInt32(&c.writers, 0) // no pending results
+	c.failed = false                 // new connection
+	if c.invalidateCallback != nil { // invalidations might get lost
+		c.invalidateCallback(nil)
+	}
+	m.cmds = c.session.cmds()
+	for name, cb := range c.channelMap {
+		m.subs = append(m.subs, subscription{name: name, cb: cb})
+	}
+	for name, cb := range c.patternMap {
+		m.subs = append(m.subs, subscription{name: name, kind: subscriptionPattern, cb: cb})
+	}
+	for name, cb := range c.shardMap {
+		m.subs = append(m.subs, subscription{name: name, kind: subscriptionShard, cb: cb})
+	}
+	close(m.done)
+}
+
+// reconnect is called by the watcher after the connection got lost.
+// It returns the error causing the connection shutdown in case reconnecting is not possible.
+func (c *conn) reconnect(err error, wg *sync.WaitGroup, errChan chan error) error {
+	for {
+		c.flushMu.Lock() // stop sending commands
+		if err = c.reconnectLocked(err, wg, errChan); err != nil {
+			atomic.StoreInt32(&c.inShutdown, 1) // fail pending commands
+			c.flushMu.Unlock()
+			return err
+		}
+		c.flushMu.Unlock()
+
+		err = <-errChan // wait for next connection loss
+		wg.Wait()
+	}
+}
+
+func (c *conn) reconnectLocked(err error, wg *sync.WaitGroup, errChan chan error) error {
+	backoff := c.dialer.reconnectBackoff()
+
+	for attempt := 1; ; attempt++ {
+		m := &resetMarker{err: &ConnLostError{Err: err}, done: make(chan struct{})}
+		c.readChan <- m
+		<-m.done
+
+		select {
+		case <-c.closeCh:
+			return err
+		default:
+		}
+
+		if c.dialer.MaxReconnectAttempts > 0 && attempt > c.dialer.MaxReconnectAttempts {
+			c.logf("reconnect failed after %d attempts: %s", attempt-1, err)
+			return err
+		}
+
+		c.logf("connection lost: %s - reconnect attempt %d", err, attempt)
+
+		select {
+		case <-time.After(backoff(attempt)):
+		case <-c.closeCh:
+			return err
+		}
+
+		netConn, dialErr := c.dialer.dialNetConn(context.Background(), c.address)
+		if dialErr != nil {
+			err = dialErr
+			continue
+		}
+
+		c.closeNetConn() // close lost connection
+		c.setNetConn(netConn)
+
+		wg.Add(1)
+		go c.reader(wg, c.readChan, errChan)
+
+		hello, results := c.handshakeLocked(m)
+
+		done := make(chan error, 1)
+		go func() { done <- waitResults(results) }()
+
+		select {
+		case err = <-errChan: // connection lost during handshake
+			wg.Wait()
+		case hErr := <-done:
+			if hErr == nil {
+				c.setHello(hello)
+				c.logf("reconnected to %s", c.netConn.RemoteAddr())
+				return nil
+			}
+			err = hErr
+			c.closeNetConn()
+			<-errChan
+			wg.Wait()
+		}
+	}
+}
+
+// handshakeLocked sends the commands restoring the connection state.
+// The hello command result is nil for RESP2 connections.
+func (c *conn) handshakeLocked(m *resetMarker) (Result, []*result) {
+	batch := freeResults.get()
+	cmd := newCommand(func(name string, r *result) { batch = append(batch, r) }, nil)
+
+	var hello Result
+	if !c.isRESP2() { // RESP2 authentication and client name are restored by the session commands
+		hello = c.helloCmd(cmd)
+	}
+	for _, v := range m.cmds {
+		cmd.Do(v...)
+	}
+	for _, sub := range m.subs {
+		switch sub.kind {
+		case subscriptionPattern:
+			cmd.Psubscribe([]string{sub.name}, sub.cb)
+		case subscriptionShard:
+			cmd.Ssubscribe([]string{sub.name}, sub.cb)
+		default:
+			cmd.Subscribe([]string{sub.name}, sub.cb)
+		}
+	}
+
+	results := make([]*result, len(batch))
+	copy(results, batch)
+	c.flushLocked(true, batch)
+	return hello, results
+}
+
+// waitResults waits for all results and returns the first error.
+func waitResults(results []*result) error {
+	var err error
+	for _, r := range results {
+		if rErr := r.Err(); rErr != nil && err == nil {
+			err = rErr
+		}
+	}
+	return err
+}
+
+func (c *conn) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBackoff(d time.Duration) Backoff { return func(int) time.Duration { return d } }
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second)
+
+	var tests = []struct {
+		n int
+		d time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+
+	for i, test := range tests {
+		if d := backoff(test.n); d != test.d {
+			t.Fatalf("line: %d got: %s expected: %s", i, d, test.d)
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	d := &Dialer{Reconnect: true, ReconnectBackoff: testBackoff(10 * time.Millisecond), ClientName: "test"}
+	c, err := d.Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := make(chan string, 10)
+	if err := c.Subscribe([]string{"ch"}, func(pattern, channel, msg string) { msgs <- msg }).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ssubscribe([]string{"sch"}, func(pattern, channel, msg string) { msgs <- "s" + msg }).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Select(2).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("key", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.dropAll()
+	time.Sleep(100 * time.Millisecond)
+
+	v, err := c.Get("key").ToString()
+	if err != nil { // command might be in flight while connection gets lost
+		var connLostErr *ConnLostError
+		if !errors.As(err, &connLostErr) {
+			t.Fatalf("got: %v expected: %T", err, connLostErr)
+		}
+		v, err = c.Get("key").ToString()
+	}
+	if err != nil || v != "value" {
+		t.Fatalf("got: %s %v expected: %s", v, err, "value")
+	}
+
+	if err := c.Publish("ch", "msg").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Spublish("sch", "msg").Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"msg", "smsg"} {
+		select {
+		case msg := <-msgs:
+			if msg != expected {
+				t.Fatalf("got: %s expected: %s", msg, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscription not restored")
+		}
+	}
+
+	s.mu.Lock()
+	cmds := strings.Join(s.cmds, "|")
+	s.mu.Unlock()
+	const restored = "HELLO 3 SETNAME test|SELECT 2|SUBSCRIBE ch|SSUBSCRIBE sch"
+	if strings.Count(cmds, restored) != 1 {
+		t.Fatalf("got: %s expected: %s", cmds, restored)
+	}
+
+	if n, err := c.Sunsubscribe(nil).ToInt64(); err != nil || n != 1 { // channel subscription left
+		t.Fatalf("got: %d %v expected: %d", n, err, 1)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconnectMaxAttempts(t *testing.T) {
+	s := newFakeServer(t)
+
+	d := &Dialer{Reconnect: true, MaxReconnectAttempts: 2, ReconnectBackoff: testBackoff(10 * time.Millisecond)}
+	c, err := d.Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.ln.Close()
+	s.dropAll()
+	time.Sleep(200 * time.Millisecond)
+
+	if err := c.Get("key").Err(); err != ErrInShutdown {
+		t.Fatalf("got: %v expected: %v", err, ErrInShutdown)
+	}
+	c.Close()
+}
+
+func TestReconnectClose(t *testing.T) {
+	s := newFakeServer(t)
+
+	d := &Dialer{Reconnect: true, ReconnectBackoff: testBackoff(50 * time.Millisecond)}
+	c, err := d.Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.ln.Close()
+	s.dropAll()
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan error)
+	go func() { done <- c.Close() }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("close while reconnecting does not return")
+	}
+}
@@ -66,6 +66,7 @@ var _ baseRedisType = (*_number)(nil)
 var _ baseRedisType = (*_bignumber)(nil)
 var _ baseRedisType = (*_double)(nil)
 var _ baseRedisType = (*_boolean)(nil)
+var _ baseRedisType = (*_error)(nil)
 
 var _ RedisValue = (*_null)(nil)
 var _ RedisValue = (*_string)(nil)
@@ -73,6 +74,7 @@ var _ RedisValue = (*_number)(nil)
 var _ RedisValue = (*_bignumber)(nil)
 var _ RedisValue = (*_double)(nil)
 var _ RedisValue = (*_boolean)(nil)
+var _ RedisValue = (*_error)(nil)
 
 var _ RedisValue = (*_verbatimString)(nil)
 var _ RedisValue = (*_slice)(nil)
@@ -176,6 +178,12 @@ func (b _boolean) ToFloat64() (float64, error) {
 }
 func (b _boolean) ToBool() (bool, error) { return bool(b), nil }
 
+// _error is an error reply within an aggregate value (e.g. the reply of a failed command within an EXEC reply).
+type _error struct{ err *RedisError }
+
+func (e _error) _interface() interface{} { return e.err }
+func (e _error) Kind() RedisKind         { return RkError }
+
 type _verbatimString string
 
 func (s _verbatimString) Kind() RedisKind                           { return RkVerbatimString }
@@ -361,3 +361,47 @@ func (s _set) ToVerbatimString() (VerbatimString, error) {
 }
 func (s _set) ToXrange() ([]XItem, error)           { return nil, newConversionError("ToXrange", s) }
 func (s _set) ToXread() (map[string][]XItem, error) { return nil, newConversionError("ToXread", s) }
+
+func (e _error) Attr() *Map                     { return nil }
+func (e _error) ToBool() (bool, error)          { return false, newConversionError("ToBool", e) }
+func (e _error) ToFloat64() (float64, error)    { return 0, newConversionError("ToFloat64", e) }
+func (e _error) ToInt64() (int64, error)        { return 0, newConversionError("ToInt64", e) }
+func (e _error) ToInt64Slice() ([]int64, error) { return nil, newConversionError("ToInt64Slice", e) }
+func (e _error) ToIntfSlice() ([]interface{}, error) {
+	return nil, newConversionError("ToIntfSlice", e)
+}
+func (e _error) ToIntfSlice2() ([][]interface{}, error) {
+	return nil, newConversionError("ToIntfSlice2", e)
+}
+func (e _error) ToIntfSlice3() ([][][]interface{}, error) {
+	return nil, newConversionError("ToIntfSlice3", e)
+}
+func (e _error) ToMap() (Map, error)       { return nil, newConversionError("ToMap", e) }
+func (e _error) ToSet() (Set, error)       { return nil, newConversionError("ToSet", e) }
+func (e _error) ToSlice() (Slice, error)   { return nil, newConversionError("ToSlice", e) }
+func (e _error) ToString() (string, error) { return "", newConversionError("ToString", e) }
+func (e _error) ToStringInt64Map() (map[string]int64, error) {
+	return nil, newConversionError("ToStringInt64Map", e)
+}
+func (e _error) ToStringMap() (map[string]interface{}, error) {
+	return nil, newConversionError("ToStringMap", e)
+}
+func (e _error) ToStringMapSlice() ([]map[string]interface{}, error) {
+	return nil, newConversionError("ToStringMapSlice", e)
+}
+func (e _error) ToStringSet() (map[string]bool, error) {
+	return nil, newConversionError("ToStringSet", e)
+}
+func (e _error) ToStringSlice() ([]string, error) { return nil, newConversionError("ToStringSlice", e) }
+func (e _error) ToStringStringMap() (map[string]string, error) {
+	return nil, newConversionError("ToStringStringMap", e)
+}
+func (e _error) ToStringValueMap() (map[string]RedisValue, error) {
+	return nil, newConversionError("ToStringValueMap", e)
+}
+func (e _error) ToTree() ([]interface{}, error) { return nil, newConversionError("ToTree", e) }
+func (e _error) ToVerbatimString() (VerbatimString, error) {
+	return "", newConversionError("ToVerbatimString", e)
+}
+func (e _error) ToXrange() ([]XItem, error)           { return nil, newConversionError("ToXrange", e) }
+func (e _error) ToXread() (map[string][]XItem, error) { return nil, newConversionError("ToXread", e) }
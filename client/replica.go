@@ -0,0 +1,135 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// OpenReplicaDB opens a new database routing read-only commands (please see ReadonlyCommands)
+// to the replicas and all other commands to the master.
+// Replicas are used round-robin. If no replica address is provided, all commands are sent to the master.
+// The pool settings are applied to the master and to each replica pool.
+func OpenReplicaDB(master string, replicas []string, dialer Dialer) DB {
+	return newReplicaDB(master, replicas, dialer)
+}
+
+// check interface implementations.
+var (
+	_ DB = (*replicaDB)(nil)
+)
+
+type replicaDB struct {
+	next     uint32 // atomic access - round-robin replica index
+	master   *db
+	replicas []*db
+
+	*command
+}
+
+func newReplicaDB(master string, replicas []string, dialer Dialer) *replicaDB {
+	rdb := &replicaDB{
+		master:   newDB(master, dialer),
+		replicas: make([]*db, len(replicas)),
+	}
+	for i, addr := range replicas {
+		rdb.replicas[i] = newDB(addr, dialer)
+		rdb.replicas[i].onConnect = readonlyConn
+	}
+	rdb.command = newCommand(rdb.send, nil)
+	return rdb
+}
+
+// readonlyConn enables read queries on a (cluster) replica connection.
+// Replicas not running in cluster mode reject READONLY, but are serving
+// read queries anyway - so a Redis error is ignored.
+func readonlyConn(c *conn) error {
+	err := c.Readonly().Err()
+	if _, ok := err.(*RedisError); ok {
+		return nil
+	}
+	return err
+}
+
+func (rdb *replicaDB) private() {} // private interface
+
+func (rdb *replicaDB) WithContext(ctx context.Context) Commands {
+	return newCommand(contextSend(ctx, rdb.send), nil)
+}
+
+// Conn returns a connection to the master.
+func (rdb *replicaDB) Conn(ctx context.Context) (Conn, error) { return rdb.master.Conn(ctx) }
+
+func (rdb *replicaDB) Tx(ctx context.Context, keys []interface{}, fn TxFunc) error {
+	return rdb.master.Tx(ctx, keys, fn)
+}
+
+func (rdb *replicaDB) Close() error {
+	err := rdb.master.close()
+	for _, replica := range rdb.replicas {
+		replica.close()
+	}
+	return err
+}
+
+func (rdb *replicaDB) SetConnMaxIdleTime(d time.Duration) {
+	rdb.each(func(node *db) { node.SetConnMaxIdleTime(d) })
+}
+
+func (rdb *replicaDB) SetConnMaxLifetime(d time.Duration) {
+	rdb.each(func(node *db) { node.SetConnMaxLifetime(d) })
+}
+
+func (rdb *replicaDB) SetMaxIdleConns(n int) { rdb.each(func(node *db) { node.SetMaxIdleConns(n) }) }
+func (rdb *replicaDB) SetMaxOpenConns(n int) { rdb.each(func(node *db) { node.SetMaxOpenConns(n) }) }
+
+// Stats returns the accumulated statistics of the master and replica pools.
+func (rdb *replicaDB) Stats() DBStats {
+	var stats DBStats
+	rdb.each(func(node *db) {
+		s := node.dbStats()
+		stats.MaxOpenConnections += s.MaxOpenConnections
+		stats.Idle += s.Idle
+		stats.OpenConnections += s.OpenConnections
+		stats.InUse += s.InUse
+		stats.WaitCount += s.WaitCount
+		stats.WaitDuration += s.WaitDuration
+		stats.MaxIdleClosed += s.MaxIdleClosed
+		stats.MaxIdleTimeClosed += s.MaxIdleTimeClosed
+		stats.MaxLifetimeClosed += s.MaxLifetimeClosed
+		stats.UnhealthyClosed += s.UnhealthyClosed
+	})
+	return stats
+}
+
+func (rdb *replicaDB) each(fn func(node *db)) {
+	fn(rdb.master)
+	for _, replica := range rdb.replicas {
+		fn(replica)
+	}
+}
+
+func (rdb *replicaDB) send(name string, r *result) {
+	if len(rdb.replicas) == 0 || !ReadonlyCommands[name] {
+		rdb.master.send(name, r)
+		return
+	}
+	i := atomic.AddUint32(&rdb.next, 1)
+	rdb.replicas[i%uint32(len(rdb.replicas))].send(name, r)
+}
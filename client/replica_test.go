@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReplicaDB(t *testing.T) {
+	master, replica1, replica2 := newFakeServer(t), newFakeServer(t), newFakeServer(t)
+	defer master.ln.Close()
+	defer replica1.ln.Close()
+	defer replica2.ln.Close()
+
+	// replica2 is not running in cluster mode
+	replica2.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		if !strings.EqualFold(cmd[0], "readonly") {
+			return false
+		}
+		w.WriteString("-ERR This instance has cluster support disabled\r\n")
+		return true
+	}
+
+	replica1.kv["key"] = "replica1"
+	replica2.kv["key"] = "replica2"
+
+	db := OpenReplicaDB(master.addr(), []string{replica1.addr(), replica2.addr()}, Dialer{})
+	defer db.Close()
+
+	if err := db.Set("key", "master").Err(); err != nil {
+		t.Fatal(err)
+	}
+	master.mu.Lock()
+	v := master.kv["key"]
+	master.mu.Unlock()
+	if v != "master" {
+		t.Fatalf("got: %s expected: %s", v, "master")
+	}
+
+	values := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		v, err := db.Get("key").ToString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[v] = true
+	}
+	if len(values) != 2 || !values["replica1"] || !values["replica2"] {
+		t.Fatalf("reads not distributed to replicas: %v", values)
+	}
+
+	for _, s := range []*fakeServer{master, replica1, replica2} {
+		s.mu.Lock()
+		cmds := strings.Join(s.cmds, ",")
+		s.mu.Unlock()
+		readonly := strings.Contains(strings.ToUpper(cmds), "READONLY")
+		if readonly == (s == master) {
+			t.Fatalf("unexpected READONLY usage: %s", cmds)
+		}
+	}
+}
+
+func TestReplicaDBNoReplicas(t *testing.T) {
+	master := newFakeServer(t)
+	defer master.ln.Close()
+
+	db := OpenReplicaDB(master.addr(), nil, Dialer{})
+	defer db.Close()
+
+	if err := db.Set("key", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+	v, err := db.Get("key").ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "value" {
+		t.Fatalf("got: %s expected: %s", v, "value")
+	}
+}
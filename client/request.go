@@ -17,6 +17,7 @@ limitations under the License.
 package client
 
 import (
+	"io"
 	"sync"
 	"time"
 )
@@ -61,6 +62,9 @@ func (p *requestPool) put(r *request) {
 		return
 	}
 	r.cb = nil
+	r.onAck = nil
+	r.onDone = nil
+	r.w = nil
 	r.cmd = r.cmd[:0]
 	p.size++
 	r.next = p.free
@@ -71,11 +75,23 @@ func (p *requestPool) put(r *request) {
 type request struct {
 	cmd     []interface{} // Redis command 'token'
 	done    chan bool
-	cb      MsgCallback // pubsub callback function
+	cb      MsgCallback                             // pubsub callback function
+	onAck   func(value RedisValue, err error) error // called by result ack returning the result error - nil otherwise
+	onDone  func()                                  // called by result ack after the result is set - nil otherwise
+	w       io.Writer                               // bulk string reply writer - nil otherwise
 	timeout time.Duration
 	next    *request
 }
 
+// copyFrom copies the command and the reply handling of src (callback and writer) to r.
+// Acknowledge hooks are not copied, as they are applied by the acknowledgement of src.
+func (r *request) copyFrom(src *request) {
+	r.cmd = append(r.cmd[:0], src.cmd...)
+	r.cb = src.cb
+	r.w = src.w
+	r.timeout = src.timeout
+}
+
 func newRequest() *request {
 	return &request{
 		cmd:  make([]interface{}, 0, defCmdSize),
@@ -0,0 +1,135 @@
+/*
+Copyright 2019 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"sync/atomic"
+)
+
+// A resp2Reply is the RESP3 reply type of a command replying with a flat array in RESP2.
+type resp2Reply int
+
+const (
+	resp2Map      resp2Reply = iota // map
+	resp2Set                        // set
+	resp2MapSlice                   // array of maps
+)
+
+// resp2Replies are the commands replying with a map or set in RESP3.
+var resp2Replies = map[string]resp2Reply{
+	"HGETALL":  resp2Map,
+	"SMEMBERS": resp2Set,
+	"SINTER":   resp2Set,
+	"SUNION":   resp2Set,
+	"SDIFF":    resp2Set,
+}
+
+// resp2SubReplies are the subcommands replying with a map or set in RESP3.
+var resp2SubReplies = map[string]map[string]resp2Reply{
+	"CONFIG": {"GET": resp2Map},
+	"CLIENT": {"TRACKINGINFO": resp2Map},
+	"MEMORY": {"STATS": resp2Map},
+	"XINFO":  {"STREAM": resp2Map, "GROUPS": resp2MapSlice, "CONSUMERS": resp2MapSlice},
+}
+
+// resp2Value converts the RESP2 reply v of command cmd to the RESP3 reply type (handler only).
+func resp2Value(cmd []interface{}, v RedisValue) RedisValue {
+	name := cmdToken(cmd, 0)
+	reply, ok := resp2Replies[name]
+	if !ok {
+		if reply, ok = resp2SubReplies[name][cmdToken(cmd, 1)]; !ok {
+			return v
+		}
+	}
+	s, ok := v.(_slice)
+	if !ok { // null, ...
+		return v
+	}
+	switch reply {
+	case resp2Map:
+		return resp2ToMap(s)
+	case resp2Set:
+		return _set(s)
+	default:
+		for i, e := range s {
+			if e, ok := e.(_slice); ok {
+				s[i] = resp2ToMap(e)
+			}
+		}
+		return s
+	}
+}
+
+// resp2ToMap returns the flat key value array s as map.
+func resp2ToMap(s _slice) RedisValue {
+	if len(s)%2 != 0 {
+		return s
+	}
+	m := make(_map, len(s)/2)
+	for i := range m {
+		m[i] = MapItem{Key: s[2*i], Value: s[2*i+1]}
+	}
+	return m
+}
+
+// isSubscribeCmd returns true if cmd is a channel, pattern or shard channel subscription.
+func isSubscribeCmd(cmd []interface{}) bool {
+	switch cmdToken(cmd, 0) {
+	case "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE":
+		return true
+	default:
+		return false
+	}
+}
+
+// resp2Notification returns the notification of a RESP2 pubsub message array val.
+// Other values are returned unchanged.
+func resp2Notification(val interface{}) (interface{}, error) {
+	v := val
+	reply, isArena := val.(*arenaReply)
+	if isArena {
+		v = reply.value
+	}
+	s, ok := v.(_slice)
+	if !ok || len(s) == 0 {
+		return val, nil
+	}
+	kind, ok := s[0].(_string)
+	if !ok {
+		return val, nil
+	}
+	switch kind {
+	case pubSubSubscribe, pubSubUnsubscribe, pubSubPsubscribe, pubSubPunsubscribe, pubSubSsubscribe, pubSubSunsubscribe,
+		pubSubMessage, pubSubPMessage, pubSubSMessage:
+		if isArena { // notification does not reference the arena
+			defer reply.arena.release()
+		}
+		return newNotification(s)
+	default:
+		return val, nil
+	}
+}
+
+// setPubsub switches a RESP2 connection to pubsub framing in case results include a subscription.
+func (c *conn) setPubsub(results []*result) {
+	for _, r := range results {
+		if isSubscribeCmd(r.request.cmd) {
+			atomic.StoreInt32(&c.pubsub, 1)
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRESP2(t *testing.T) {
+	s := newRESP2FakeServer(t)
+	defer s.ln.Close()
+
+	s.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		if strings.ToUpper(cmd[0]) != "SMEMBERS" {
+			return false
+		}
+		w.WriteString("*2\r\n")
+		bulk(w, "a")
+		bulk(w, "b")
+		return true
+	}
+
+	if _, err := Dial(s.addr()); err == nil { // RESP3 only
+		t.Fatal("expected error")
+	}
+
+	conn, err := (&Dialer{Protocol: ProtocolFallback, Password: "secret", ClientName: "test"}).Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if protocol := conn.ConnInfo().Protocol; protocol != 2 {
+		t.Fatalf("got: %d expected: %d", protocol, 2)
+	}
+	for _, cmd := range []string{"AUTH SECRET", "CLIENT SETNAME TEST"} {
+		if n := s.countCmds(cmd); n != 1 {
+			t.Fatalf("command %s not sent", cmd)
+		}
+	}
+
+	if err := conn.HsetStruct("hash", hashAddress{City: "Berlin", Zip: "10115"}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	p := conn.Pipeline()
+	r1 := p.Get("unknown")
+	r2 := p.GetTo("unknown", &b)
+	r3 := p.Hgetall("hash")
+	r4 := p.Hmget("hash", []interface{}{"City", "unknown"})
+	r5 := p.Smembers("set")
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []Result{r1, r2} {
+		if null, err := r.IsNull(); err != nil || !null {
+			t.Fatalf("got: %v expected: null", err)
+		}
+	}
+	if m, err := r3.ToStringStringMap(); err != nil || !reflect.DeepEqual(m, map[string]string{"City": "Berlin", "Zip": "10115"}) {
+		t.Fatalf("unexpected result %v %v", m, err)
+	}
+	if v, err := r4.Value(); err != nil || !reflect.DeepEqual(v, _slice{_string("Berlin"), _Null}) {
+		t.Fatalf("unexpected result %v %v", v, err)
+	}
+	if v, err := r5.Value(); err != nil || !reflect.DeepEqual(v, _set{_string("a"), _string("b")}) {
+		t.Fatalf("unexpected result %v %v", v, err)
+	}
+}
+
+func TestRESP2Subscriber(t *testing.T) {
+	s := newRESP2FakeServer(t)
+	defer s.ln.Close()
+
+	sub, err := DialSubscriber(context.Background(), s.addr(), Dialer{Protocol: ProtocolRESP2}, SubscriberOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if n := s.countCmds("HELLO"); n != 0 {
+		t.Fatal("unexpected HELLO command")
+	}
+
+	if n, err := sub.Subscribe("ch1", "ch2"); err != nil || n != 2 {
+		t.Fatalf("got: %d %v expected: %d", n, err, 2)
+	}
+	if n, err := sub.Psubscribe("ch*"); err != nil || n != 3 {
+		t.Fatalf("got: %d %v expected: %d", n, err, 3)
+	}
+
+	s.publish("ch1", "msg")
+	s.ppublish("ch*", "ch2", "pmsg")
+	for _, expected := range []Message{{Channel: "ch1", Payload: "msg"}, {Pattern: "ch*", Channel: "ch2", Payload: "pmsg"}} {
+		select {
+		case msg := <-sub.Messages():
+			if msg != expected {
+				t.Fatalf("got: %v expected: %v", msg, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not received")
+		}
+	}
+
+	if n, err := sub.Unsubscribe(); err != nil || n != 1 {
+		t.Fatalf("got: %d %v expected: %d", n, err, 1)
+	}
+}
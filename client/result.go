@@ -17,6 +17,7 @@ limitations under the License.
 package client
 
 import (
+	"context"
 	"errors"
 	"runtime"
 	"sync/atomic"
@@ -38,13 +39,28 @@ type Result interface {
 	// - ErrNotFlushed: result not received yet (pipeline not flushed).
 	// - ErrTimeout: timeout reached before result is available.
 	// - RedisError: redis error message if a redis command was executed unsuccessfully.
+	// - context error: the context bound to the command is done before the result is available.
 	Err() error
+	// ErrContext is like Err but waits for the result until ctx is done.
+	// In case ctx is done before the result is available, ctx.Err() is returned and
+	// the result can be waited for again later.
+	ErrContext(ctx context.Context) error
 	// IsNull returns <true> if the redis value is null.
 	IsNull() (bool, error)
 	// Kind returns the type of a Redis value.
 	Kind() (RedisKind, error)
 	// Value returns a Redis value.
 	Value() (RedisValue, error)
+	// Scan decodes the Redis value into dst (please see function Scan).
+	Scan(dst interface{}) error
+	// Release returns the memory of a result value decoded into a reply arena to the pool
+	// (please see Dialer.ReplyArena) and is a no-op otherwise.
+	// The arena is released automatically by conversion methods not returning Redis values
+	// (all conversion methods except ToMap, ToSet, ToSlice, ToStringValueMap, ToIntfSlice,
+	// ToIntfSlice2, ToIntfSlice3, ToStringMap, ToStringMapSlice and ToTree).
+	// After the arena is released, the result value and Redis values obtained from it must
+	// not be used anymore and the result returns ErrReleased.
+	Release()
 	// Conversion methods.
 	Converter
 }
@@ -61,7 +77,9 @@ type result struct {
 	// caution: field alignment (memory consumption)
 	value   RedisValue
 	err     error
+	ctx     context.Context // bound context - nil otherwise
 	request *request
+	arena   *replyArena // reply arena backing the value - nil otherwise
 	flags   uint32
 }
 
@@ -88,6 +106,10 @@ func (r *result) flush() {
 }
 
 func (r *result) wait() error {
+	return r.waitContext(r.ctx)
+}
+
+func (r *result) waitContext(ctx context.Context) error {
 	if atomic.LoadUint32(&r.flags) == rsNotFlushed {
 		return ErrNotFlushed
 	}
@@ -100,7 +122,20 @@ func (r *result) wait() error {
 	}
 
 	// wait for done signal
-	<-r.request.done
+	done := r.request.done
+	if ctx == nil {
+		<-done
+	} else {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			// stop waiting - result gets acknowledged without signaling
+			if atomic.CompareAndSwapUint32(&r.flags, rsWaiting, rsFlushed) {
+				return ctx.Err()
+			}
+			<-done // result is already being set
+		}
+	}
 	if atomic.LoadUint32(&r.flags) != rsAvailable {
 		panic("result - inconsistent state")
 	}
@@ -108,11 +143,22 @@ func (r *result) wait() error {
 }
 
 func (r *result) ack(value RedisValue, err error) {
-	// todo - state type + check state
-
-	isWaiting := !atomic.CompareAndSwapUint32(&r.flags, rsFlushed, rsSetting)
+	var isWaiting bool
+	switch {
+	case atomic.CompareAndSwapUint32(&r.flags, rsFlushed, rsSetting):
+	case atomic.CompareAndSwapUint32(&r.flags, rsWaiting, rsSetting):
+		isWaiting = true
+	default:
+		panic("result - inconsistent state")
+	}
 	r.value = value
 	r.err = err
+	if r.request.onAck != nil {
+		r.err = r.request.onAck(value, err)
+	}
+	if r.request.onDone != nil {
+		r.request.onDone()
+	}
 	atomic.StoreUint32(&r.flags, rsAvailable)
 	if isWaiting {
 		r.request.done <- true
@@ -131,6 +177,7 @@ func (r *result) setTimeout(timeout time.Duration) {
 // - ErrNotFlushed: result not received yet (pipeline not flushed).
 // - ErrTimeout: timeout reached before result is available.
 // - RedisError: redis error message if a redis command was executed unsuccessfully.
+// - context error: the context bound to the command is done before the result is available.
 func (r *result) Err() error {
 	if err := r.wait(); err != nil {
 		return err
@@ -138,6 +185,13 @@ func (r *result) Err() error {
 	return r.err
 }
 
+// ErrContext is like Err but waits for the result until ctx is done.
+// In case ctx is done before the result is available, ctx.Err() is returned and
+// the result can be waited for again later.
+func (r *result) ErrContext(ctx context.Context) error {
+	return r.waitContext(ctx)
+}
+
 // Kind returns the type of a Redis value.
 func (r *result) Kind() (RedisKind, error) {
 	if err := r.wait(); err != nil {
@@ -154,6 +208,34 @@ func (r *result) Value() (RedisValue, error) {
 	return r.value, nil
 }
 
+// Scan decodes the Redis value into dst (please see function Scan).
+func (r *result) Scan(dst interface{}) error {
+	if err := r.wait(); err != nil {
+		return err
+	}
+	return Scan(r.value, dst)
+}
+
+// Release returns the memory of a result value decoded into a reply arena to the pool
+// (please see Dialer.ReplyArena) and is a no-op otherwise.
+func (r *result) Release() {
+	if err := r.wait(); err != nil {
+		return
+	}
+	r.release()
+}
+
+// release releases the reply arena of an available result.
+func (r *result) release() {
+	if r.arena == nil {
+		return
+	}
+	r.arena.release()
+	r.arena = nil
+	r.value = nil
+	r.err = ErrReleased
+}
+
 // Attr returns the attribute of a Redis value if provided - <nil> otherwise.
 func (r *result) Attr() (*Map, error) {
 	if err := r.wait(); err != nil {
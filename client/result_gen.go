@@ -8,6 +8,7 @@ func (r *result) ToBool() (bool, error) {
 	if err := r.wait(); err != nil {
 		return false, err
 	}
+	defer r.release()
 	return r.value.ToBool()
 }
 
@@ -17,6 +18,7 @@ func (r *result) ToFloat64() (float64, error) {
 	if err := r.wait(); err != nil {
 		return 0, err
 	}
+	defer r.release()
 	return r.value.ToFloat64()
 }
 
@@ -26,6 +28,7 @@ func (r *result) ToInt64() (int64, error) {
 	if err := r.wait(); err != nil {
 		return 0, err
 	}
+	defer r.release()
 	return r.value.ToInt64()
 }
 
@@ -35,6 +38,7 @@ func (r *result) ToInt64Slice() ([]int64, error) {
 	if err := r.wait(); err != nil {
 		return nil, err
 	}
+	defer r.release()
 	return r.value.ToInt64Slice()
 }
 
@@ -97,6 +101,7 @@ func (r *result) ToString() (string, error) {
 	if err := r.wait(); err != nil {
 		return "", err
 	}
+	defer r.release()
 	return r.value.ToString()
 }
 
@@ -106,6 +111,7 @@ func (r *result) ToStringInt64Map() (map[string]int64, error) {
 	if err := r.wait(); err != nil {
 		return nil, err
 	}
+	defer r.release()
 	return r.value.ToStringInt64Map()
 }
 
@@ -133,6 +139,7 @@ func (r *result) ToStringSet() (map[string]bool, error) {
 	if err := r.wait(); err != nil {
 		return nil, err
 	}
+	defer r.release()
 	return r.value.ToStringSet()
 }
 
@@ -142,6 +149,7 @@ func (r *result) ToStringSlice() ([]string, error) {
 	if err := r.wait(); err != nil {
 		return nil, err
 	}
+	defer r.release()
 	return r.value.ToStringSlice()
 }
 
@@ -151,6 +159,7 @@ func (r *result) ToStringStringMap() (map[string]string, error) {
 	if err := r.wait(); err != nil {
 		return nil, err
 	}
+	defer r.release()
 	return r.value.ToStringStringMap()
 }
 
@@ -178,6 +187,7 @@ func (r *result) ToVerbatimString() (VerbatimString, error) {
 	if err := r.wait(); err != nil {
 		return "", err
 	}
+	defer r.release()
 	return r.value.ToVerbatimString()
 }
 
@@ -187,6 +197,7 @@ func (r *result) ToXrange() ([]XItem, error) {
 	if err := r.wait(); err != nil {
 		return nil, err
 	}
+	defer r.release()
 	return r.value.ToXrange()
 }
 
@@ -196,5 +207,6 @@ func (r *result) ToXread() (map[string][]XItem, error) {
 	if err := r.wait(); err != nil {
 		return nil, err
 	}
+	defer r.release()
 	return r.value.ToXread()
 }
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestResultContext(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	release := make(chan struct{})
+	s.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		if cmd[0] == "GET" && cmd[1] == "slow" {
+			<-release
+		}
+		return false
+	}
+
+	conn, err := Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.Set("slow", "value").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	r := conn.WithContext(ctx).Get("slow")
+	if err := r.Err(); err != context.DeadlineExceeded {
+		t.Fatalf("got: %v expected: %v", err, context.DeadlineExceeded)
+	}
+	// command sent after context is done
+	if err := conn.WithContext(ctx).Get("slow").Err(); err != context.DeadlineExceeded {
+		t.Fatalf("got: %v expected: %v", err, context.DeadlineExceeded)
+	}
+
+	r2 := conn.Get("slow")
+	if err := r2.ErrContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got: %v expected: %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+
+	// connection stays consistent
+	for _, r := range []Result{r, r2} {
+		if err := r.ErrContext(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := r2.ToString(); err != nil || v != "value" {
+		t.Fatalf("got: %s %v expected: %s", v, err, "value")
+	}
+	if v, err := conn.Get("slow").ToString(); err != nil || v != "value" {
+		t.Fatalf("got: %s %v expected: %s", v, err, "value")
+	}
+}
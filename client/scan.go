@@ -0,0 +1,458 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScanTag is the struct field tag name used by Scan and the hash struct commands.
+const ScanTag = "redis"
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	bigIntType   = reflect.TypeOf(big.Int{})
+)
+
+// Scan decodes the Redis value v into dst, which needs to be a non-nil pointer.
+//
+// Supported destination types are
+// - string, []byte, bool, integer and float types,
+// - *big.Int and time.Time (Unix time in seconds or RFC 3339 formatted string),
+// - time.Duration (milliseconds, like encoded by Encoder),
+// - slices and arrays decoded from Redis arrays and sets,
+// - maps and structs decoded from Redis maps or from arrays of key value pairs,
+// - pointers, interfaces implemented by RedisValue (like RedisValue itself) and
+//   interface{} (string, int64, float64, *big.Int, bool, []interface{} or map[string]interface{}).
+//
+// Struct fields are matched by the field tag `redis:"name"` or, if not tagged, by the
+// case insensitive field name. Fields tagged with `redis:"-"` and map keys without a
+// corresponding field are ignored. The fields of anonymous struct fields without tag
+// are treated as fields of the outer struct. Values of fields with tag option json
+// (e.g. `redis:"name,json"`) are decoded from JSON.
+//
+// A Redis null value sets the destination to its zero value.
+// In case a value cannot be converted a ConversionError including the path of the
+// destination field is returned.
+func Scan(v RedisValue, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return newInvalidValueError("dst", dst)
+	}
+	return scanValue("", v, rv.Elem())
+}
+
+func newScanError(path string, t reflect.Type, v RedisValue) *ConversionError {
+	return &ConversionError{To: t.String(), Value: v, Path: path}
+}
+
+func scanValue(path string, v RedisValue, rv reflect.Value) error {
+	if a, ok := v.(attrRedisValue); ok {
+		v = a.RedisValue
+	}
+	t := rv.Type()
+
+	if v.Kind() == RkNull {
+		rv.Set(reflect.Zero(t))
+		return nil
+	}
+
+	switch t {
+	case timeType:
+		return scanTime(path, v, rv)
+	case durationType:
+		ms, err := v.ToInt64()
+		if err != nil {
+			return newScanError(path, t, v)
+		}
+		rv.SetInt(int64(time.Duration(ms) * time.Millisecond))
+		return nil
+	case bigIntType:
+		return scanBigInt(path, v, rv)
+	}
+
+	switch t.Kind() {
+
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(t.Elem()))
+		}
+		return scanValue(path, v, rv.Elem())
+
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			x, err := scanIntf(path, v)
+			if err != nil {
+				return err
+			}
+			rv.Set(reflect.ValueOf(x))
+			return nil
+		}
+		if !reflect.TypeOf(v).Implements(t) {
+			return newScanError(path, t, v)
+		}
+		rv.Set(reflect.ValueOf(v))
+
+	case reflect.String:
+		s, err := v.ToString()
+		if err != nil {
+			return newScanError(path, t, v)
+		}
+		rv.SetString(s)
+
+	case reflect.Bool:
+		b, err := scanBool(v)
+		if err != nil {
+			return newScanError(path, t, v)
+		}
+		rv.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := v.ToInt64()
+		if err != nil || rv.OverflowInt(i) {
+			return newScanError(path, t, v)
+		}
+		rv.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s, err := v.ToString()
+		if err != nil {
+			return newScanError(path, t, v)
+		}
+		u, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return newScanError(path, t, v)
+		}
+		rv.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := v.ToFloat64()
+		if err != nil || rv.OverflowFloat(f) {
+			return newScanError(path, t, v)
+		}
+		rv.SetFloat(f)
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 { // []byte
+			s, err := v.ToString()
+			if err != nil {
+				return newScanError(path, t, v)
+			}
+			rv.SetBytes([]byte(s))
+			return nil
+		}
+		items, ok := scanSlice(v)
+		if !ok {
+			return newScanError(path, t, v)
+		}
+		s := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			if err := scanValue(path+"["+strconv.Itoa(i)+"]", item, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		rv.Set(s)
+
+	case reflect.Array:
+		items, ok := scanSlice(v)
+		if !ok || len(items) > t.Len() {
+			return newScanError(path, t, v)
+		}
+		for i := 0; i < t.Len(); i++ {
+			if i >= len(items) {
+				rv.Index(i).Set(reflect.Zero(t.Elem()))
+				continue
+			}
+			if err := scanValue(path+"["+strconv.Itoa(i)+"]", items[i], rv.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		items, ok := scanMap(v)
+		if !ok {
+			return newScanError(path, t, v)
+		}
+		m := reflect.MakeMapWithSize(t, len(items))
+		for _, item := range items {
+			key := reflect.New(t.Key()).Elem()
+			if err := scanValue(path, item.Key, key); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := scanValue(path+"["+scanKey(item.Key)+"]", item.Value, value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		rv.Set(m)
+
+	case reflect.Struct:
+		items, ok := scanMap(v)
+		if !ok {
+			return newScanError(path, t, v)
+		}
+		fields := structFields(t)
+		for _, item := range items {
+			name, err := item.Key.ToString()
+			if err != nil {
+				return newScanError(path, t, item.Key)
+			}
+			field, ok := fields.lookup(name)
+			if !ok {
+				continue
+			}
+			fieldPath := field.name
+			if path != "" {
+				fieldPath = path + "." + field.name
+			}
+			fv := rv.FieldByIndex(field.index)
+			if field.json {
+				if err := scanJSON(fieldPath, item.Value, fv); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := scanValue(fieldPath, item.Value, fv); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return newScanError(path, t, v)
+	}
+	return nil
+}
+
+// scanSlice returns the items of Redis arrays and sets.
+func scanSlice(v RedisValue) ([]RedisValue, bool) {
+	switch v := v.(type) {
+	case _slice:
+		return v, true
+	case _set:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// scanMap returns the items of Redis maps and of arrays of key value pairs.
+func scanMap(v RedisValue) ([]MapItem, bool) {
+	switch v := v.(type) {
+	case _map:
+		return v, true
+	case _slice:
+		if len(v)%2 != 0 {
+			return nil, false
+		}
+		items := make([]MapItem, len(v)/2)
+		for i := range items {
+			items[i] = MapItem{Key: v[i*2], Value: v[i*2+1]}
+		}
+		return items, true
+	default:
+		return nil, false
+	}
+}
+
+func scanKey(v RedisValue) string {
+	if s, err := v.ToString(); err == nil {
+		return s
+	}
+	return "?"
+}
+
+// scanJSON decodes the JSON encoded Redis value v.
+func scanJSON(path string, v RedisValue, rv reflect.Value) error {
+	if v.Kind() == RkNull {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	s, err := v.ToString()
+	if err != nil {
+		return newScanError(path, rv.Type(), v)
+	}
+	if err := json.Unmarshal([]byte(s), rv.Addr().Interface()); err != nil {
+		return newScanError(path, rv.Type(), v)
+	}
+	return nil
+}
+
+func scanBool(v RedisValue) (bool, error) {
+	if s, ok := v.(_string); ok {
+		return strconv.ParseBool(string(s))
+	}
+	return v.ToBool()
+}
+
+func scanTime(path string, v RedisValue, rv reflect.Value) error {
+	switch v := v.(type) {
+	case _number:
+		rv.Set(reflect.ValueOf(time.Unix(int64(v), 0)))
+		return nil
+	case _double:
+		sec := int64(v)
+		rv.Set(reflect.ValueOf(time.Unix(sec, int64((float64(v)-float64(sec))*1e9))))
+		return nil
+	case _string:
+		if sec, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			rv.Set(reflect.ValueOf(time.Unix(sec, 0)))
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, string(v))
+		if err != nil {
+			return newScanError(path, timeType, v)
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	default:
+		return newScanError(path, timeType, v)
+	}
+}
+
+func scanBigInt(path string, v RedisValue, rv reflect.Value) error {
+	i := rv.Addr().Interface().(*big.Int)
+	switch v := v.(type) {
+	case *_bignumber:
+		i.Set((*big.Int)(v))
+	case _number:
+		i.SetInt64(int64(v))
+	case _string:
+		if _, ok := i.SetString(string(v), 10); !ok {
+			return newScanError(path, bigIntType, v)
+		}
+	default:
+		return newScanError(path, bigIntType, v)
+	}
+	return nil
+}
+
+// scanIntf returns the Go representation of a Redis value.
+func scanIntf(path string, v RedisValue) (interface{}, error) {
+	if a, ok := v.(attrRedisValue); ok {
+		v = a.RedisValue
+	}
+	switch v := v.(type) {
+	case _verbatimString:
+		return v.ToString()
+	case _slice, _set:
+		items, _ := scanSlice(v)
+		r := make([]interface{}, len(items))
+		for i, item := range items {
+			x, err := scanIntf(path+"["+strconv.Itoa(i)+"]", item)
+			if err != nil {
+				return nil, err
+			}
+			r[i] = x
+		}
+		return r, nil
+	case _map:
+		r := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			key, err := item.Key.ToString()
+			if err != nil {
+				return nil, newScanError(path, reflect.TypeOf(r), item.Key)
+			}
+			x, err := scanIntf(path+"["+key+"]", item.Value)
+			if err != nil {
+				return nil, err
+			}
+			r[key] = x
+		}
+		return r, nil
+	case baseRedisType:
+		return v._interface(), nil
+	default:
+		return nil, newScanError(path, reflect.TypeOf((*interface{})(nil)).Elem(), v)
+	}
+}
+
+// structField is a struct field mapped to a Redis map key or hash field.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool // omitempty option - skip zero values on encoding
+	json      bool // json option - value is JSON encoded
+}
+
+type structFieldList []structField
+
+// lookup returns the field with name - exact matches are preferred over case insensitive matches.
+func (l structFieldList) lookup(name string) (structField, bool) {
+	for _, f := range l {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range l {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+var structFieldCache sync.Map // map[reflect.Type]structFieldList
+
+// structFields returns the fields of struct type t defined by the field tags `redis:"name,option..."`.
+func structFields(t reflect.Type) structFieldList {
+	if l, ok := structFieldCache.Load(t); ok {
+		return l.(structFieldList)
+	}
+	l, _ := structFieldCache.LoadOrStore(t, appendStructFields(nil, t, nil))
+	return l.(structFieldList)
+}
+
+func appendStructFields(l structFieldList, t reflect.Type, index []int) structFieldList {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup(ScanTag)
+		if tag == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if sf.Anonymous && !tagged && sf.Type.Kind() == reflect.Struct {
+			l = appendStructFields(l, sf.Type, fieldIndex)
+			continue
+		}
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+		f := structField{name: sf.Name, index: fieldIndex}
+		opts := strings.Split(tag, ",")
+		if opts[0] != "" {
+			f.name = opts[0]
+		}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "omitempty":
+				f.omitEmpty = true
+			case "json":
+				f.json = true
+			}
+		}
+		l = append(l, f)
+	}
+	return l
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type scanBase struct {
+	ID string `redis:"id"`
+}
+
+type scanEntry struct {
+	ID     string
+	Fields map[string]string
+}
+
+type scanStruct struct {
+	scanBase
+	Name     string
+	Age      int8 `redis:"age"`
+	Score    float64
+	Active   bool
+	Count    uint16
+	Created  time.Time
+	Timeout  time.Duration
+	Big      *big.Int
+	Tags     []string
+	Pair     [2]int64
+	Entry    *scanEntry `redis:"first-entry"`
+	Raw      RedisValue
+	Any      interface{}
+	Ignored  string `redis:"-"`
+	internal string
+}
+
+func TestScan(t *testing.T) {
+	bigValue, _ := new(big.Int).SetString("1234567890123456789012345678901234567890", 10)
+
+	v := _map{
+		{_string("id"), _string("id1")},
+		{_string("name"), _string("Alice")}, // case insensitive
+		{_string("age"), _string("42")},
+		{_string("Score"), _double(1.5)},
+		{_string("Active"), _string("true")},
+		{_string("Count"), _number(7)},
+		{_string("Created"), _number(1600000000)},
+		{_string("Timeout"), _string("1500")},
+		{_string("Big"), (*_bignumber)(bigValue)},
+		{_string("Tags"), _set{_string("a"), _string("b")}},
+		{_string("Pair"), _slice{_number(1), _number(2)}},
+		{_string("first-entry"), _slice{ // array of key value pairs
+			_string("ID"), _string("0-1"),
+			_string("Fields"), _slice{_string("k"), _string("v")},
+		}},
+		{_string("Raw"), _number(3)},
+		{_string("Any"), _slice{_string("x"), _map{{_string("y"), _number(1)}}}},
+		{_string("Ignored"), _string("ignored")},
+		{_string("internal"), _string("internal")},
+		{_string("unknown"), _string("unknown")},
+	}
+
+	expected := scanStruct{
+		scanBase: scanBase{ID: "id1"},
+		Name:     "Alice",
+		Age:      42,
+		Score:    1.5,
+		Active:   true,
+		Count:    7,
+		Created:  time.Unix(1600000000, 0),
+		Timeout:  1500 * time.Millisecond,
+		Big:      bigValue,
+		Tags:     []string{"a", "b"},
+		Pair:     [2]int64{1, 2},
+		Entry:    &scanEntry{ID: "0-1", Fields: map[string]string{"k": "v"}},
+		Raw:      _number(3),
+		Any:      []interface{}{"x", map[string]interface{}{"y": int64(1)}},
+	}
+
+	var s scanStruct
+	if err := Scan(v, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, expected) {
+		t.Fatalf("got: %v expected: %v", s, expected)
+	}
+
+	// null
+	s.Entry = &scanEntry{}
+	if err := Scan(_map{{_string("first-entry"), _null{}}}, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Entry != nil {
+		t.Fatalf("got: %v expected: nil", s.Entry)
+	}
+}
+
+func TestScanError(t *testing.T) {
+	for _, test := range []struct {
+		v    RedisValue
+		dst  interface{}
+		path string
+	}{
+		{_map{{_string("age"), _string("old")}}, new(scanStruct), "age"},
+		{_map{{_string("age"), _number(1000)}}, new(scanStruct), "age"}, // overflow
+		{_map{{_string("Tags"), _slice{_string("a"), _map{}}}}, new(scanStruct), "Tags[1]"},
+		{_map{{_string("first-entry"), _slice{_string("Fields"), _slice{_string("k")}}}}, new(scanStruct), "first-entry.Fields"},
+		{_slice{_string("a"), _string("b"), _string("c")}, new([2]string), ""},
+		{_string("a"), new(map[string]string), ""},
+	} {
+		err := Scan(test.v, test.dst)
+		var convErr *ConversionError
+		if !errors.As(err, &convErr) {
+			t.Fatalf("got: %v expected: %T", err, convErr)
+		}
+		if convErr.Path != test.path {
+			t.Fatalf("got: %s expected: %s", convErr.Path, test.path)
+		}
+	}
+
+	var s scanStruct
+	if err := Scan(_map{}, s); err == nil { // not a pointer
+		t.Fatal("expected error")
+	}
+}
+
+func TestResultScan(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	conn, err := Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.Set("key", "42").Err(); err != nil {
+		t.Fatal(err)
+	}
+	var i int
+	if err := conn.Get("key").Scan(&i); err != nil || i != 42 {
+		t.Fatalf("got: %d %v expected: %d", i, err, 42)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMasterNotFound is returned if none of the sentinels provides an address for the master.
+var ErrMasterNotFound = errors.New(ClientName + ": sentinel: master not found")
+
+const (
+	sentinelSwitchMaster = "+switch-master"
+)
+
+// Sentinel provides Redis master discovery via Redis Sentinel.
+type Sentinel struct {
+	// Dialer used for connecting to the sentinels.
+	Dialer Dialer
+	// Sentinel addresses.
+	Addrs []string
+	// Name of the master monitored by the sentinels.
+	MasterName string
+}
+
+// MasterAddr queries the sentinels for the master address.
+// Sentinels are queried in order and the first address provided is returned.
+func (s *Sentinel) MasterAddr(ctx context.Context) (string, error) {
+	err := ErrMasterNotFound
+	for _, addr := range s.Addrs {
+		var masterAddr string
+		if masterAddr, err = s.queryMasterAddr(ctx, addr); err == nil {
+			return masterAddr, nil
+		}
+	}
+	return "", err
+}
+
+func (s *Sentinel) queryMasterAddr(ctx context.Context, addr string) (string, error) {
+	conn, err := s.Dialer.dialContext(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return s.masterAddr(conn)
+}
+
+func (s *Sentinel) masterAddr(conn *conn) (string, error) {
+	r := conn.Do("sentinel", "get-master-addr-by-name", s.MasterName)
+	if null, err := r.IsNull(); err != nil || null {
+		if err == nil {
+			err = ErrMasterNotFound
+		}
+		return "", err
+	}
+	hostPort, err := r.ToStringSlice()
+	if err != nil {
+		return "", err
+	}
+	if len(hostPort) != 2 {
+		return "", ErrMasterNotFound
+	}
+	return net.JoinHostPort(hostPort[0], hostPort[1]), nil
+}
+
+// DialMaster connects to the master provided by the sentinels.
+func (s *Sentinel) DialMaster(ctx context.Context, dialer *Dialer) (Conn, error) {
+	addr, err := s.MasterAddr(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dialer.DialContext(ctx, addr)
+}
+
+// OpenSentinelDB opens a new database connected to the master provided by the sentinels.
+// After a failover (+switch-master sentinel message) new and pooled connections are redirected to the new master.
+func OpenSentinelDB(sentinel *Sentinel, dialer Dialer) DB {
+	db := newDB("", dialer)
+	w := newSentinelWatcher(sentinel, db.redirect)
+	db.resolveAddr = w.masterAddr
+	db.onClose = w.close
+	return db
+}
+
+// sentinelWatcher keeps track of the master address by subscribing to the sentinel +switch-master messages.
+type sentinelWatcher struct {
+	s        *Sentinel
+	onSwitch func(addr string)
+
+	mu   sync.Mutex
+	addr string
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newSentinelWatcher(s *Sentinel, onSwitch func(addr string)) *sentinelWatcher {
+	w := &sentinelWatcher{s: s, onSwitch: onSwitch, stop: make(chan struct{})}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+// masterAddr returns the current master address.
+func (w *sentinelWatcher) masterAddr(ctx context.Context) (string, error) {
+	w.mu.Lock()
+	addr := w.addr
+	w.mu.Unlock()
+	if addr != "" {
+		return addr, nil
+	}
+
+	addr, err := w.s.MasterAddr(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.addr == "" { // not set by watcher in the meanwhile
+		w.addr = addr
+	}
+	return w.addr, nil
+}
+
+// setAddr sets the master address and calls onSwitch in case the address did change.
+func (w *sentinelWatcher) setAddr(addr string) {
+	w.mu.Lock()
+	switched := w.addr != "" && w.addr != addr
+	w.addr = addr
+	w.mu.Unlock()
+
+	if switched {
+		w.onSwitch(addr)
+	}
+}
+
+func (w *sentinelWatcher) close() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+func (w *sentinelWatcher) run() {
+	defer w.wg.Done()
+
+	for attempt := 1; ; attempt++ {
+		for _, addr := range w.s.Addrs {
+			if w.watch(addr) {
+				attempt = 1
+			}
+			select {
+			case <-w.stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(DefaultBackoff(attempt)):
+		}
+	}
+}
+
+// watch subscribes to the sentinel +switch-master messages and
+// returns after the sentinel connection got lost or the watcher is stopped.
+// It returns false if the sentinel is not available.
+func (w *sentinelWatcher) watch(addr string) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-w.stop:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	defer cancel()
+
+	conn, err := w.s.Dialer.dialContext(ctx, addr)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	if err := conn.Subscribe([]string{sentinelSwitchMaster}, w.switchMaster).Err(); err != nil {
+		return false
+	}
+	// query master after subscribing so that no failover gets lost
+	masterAddr, err := w.s.masterAddr(conn)
+	if err != nil {
+		return false
+	}
+	w.setAddr(masterAddr)
+
+	select {
+	case <-w.stop:
+	case <-conn.shutdown:
+	}
+	return true
+}
+
+// switchMaster handles the sentinel +switch-master message
+// <master name> <old ip> <old port> <new ip> <new port>.
+func (w *sentinelWatcher) switchMaster(pattern, channel, msg string) {
+	parts := strings.Fields(msg)
+	if len(parts) != 5 || parts[0] != w.s.MasterName {
+		return
+	}
+	w.setAddr(net.JoinHostPort(parts[3], parts[4]))
+}
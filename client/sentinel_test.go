@@ -0,0 +1,100 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func splitHostPort(t *testing.T, addr string) (string, string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
+
+func TestSentinelDB(t *testing.T) {
+	master1, master2, sentinel := newFakeServer(t), newFakeServer(t), newFakeServer(t)
+	defer master1.ln.Close()
+	defer master2.ln.Close()
+	defer sentinel.ln.Close()
+
+	var mu sync.Mutex
+	masterAddr := master1.addr()
+
+	sentinel.handle = func(c net.Conn, w *bufio.Writer, cmd []string) bool {
+		if !strings.EqualFold(cmd[0], "sentinel") {
+			return false
+		}
+		if cmd[2] != "mymaster" {
+			w.WriteString("_\r\n")
+			return true
+		}
+		mu.Lock()
+		host, port := splitHostPort(t, masterAddr)
+		mu.Unlock()
+		w.WriteString("*2\r\n")
+		bulk(w, host)
+		bulk(w, port)
+		return true
+	}
+
+	s := &Sentinel{Addrs: []string{sentinel.addr()}, MasterName: "mymaster"}
+
+	if _, err := (&Sentinel{Addrs: s.Addrs, MasterName: "unknown"}).MasterAddr(context.Background()); err != ErrMasterNotFound {
+		t.Fatalf("got: %v expected: %v", err, ErrMasterNotFound)
+	}
+
+	db := OpenSentinelDB(s, Dialer{})
+	defer db.Close()
+
+	if err := db.Set("key", "value1").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// failover
+	mu.Lock()
+	masterAddr = master2.addr()
+	mu.Unlock()
+	host1, port1 := splitHostPort(t, master1.addr())
+	host2, port2 := splitHostPort(t, master2.addr())
+	sentinel.publish(sentinelSwitchMaster, strings.Join([]string{"mymaster", host1, port1, host2, port2}, " "))
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if err := db.Set("key", "value2").Err(); err != nil {
+			t.Fatal(err)
+		}
+		master2.mu.Lock()
+		v, ok := master2.kv["key"]
+		master2.mu.Unlock()
+		if ok && v == "value2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connections not redirected to new master")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscriberSize is the default size of the subscriber message channel.
+const DefaultSubscriberSize = 100
+
+// ErrSubscriberClosed is returned when calling methods on a subscriber after the subscriber is closed.
+var ErrSubscriberClosed = errors.New(ClientName + ": subscriber is already closed")
+
+// Message is a pubsub message.
+type Message struct {
+	Pattern string // Pattern the message was received by - empty for channel subscriptions.
+	Channel string
+	Payload string
+}
+
+// OverflowPolicy defines the subscriber behavior in case the message channel is full.
+type OverflowPolicy int
+
+// Overflow policies.
+const (
+	// OverflowBlock waits until the message can be delivered.
+	// Caution: the subscriber connection is blocked until the message channel is read.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the received message.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest message in the message channel.
+	OverflowDropOldest
+)
+
+// SubscriberOptions are the subscriber options.
+type SubscriberOptions struct {
+	// Size of the message channel. Zero means DefaultSubscriberSize.
+	Size int
+	// Overflow policy.
+	Overflow OverflowPolicy
+}
+
+// Subscriber receives pubsub messages on a dedicated connection and delivers them on a Go channel.
+// In contrast to callback functions (please see MsgCallback) a slow message consumer
+// does not block the connection unless OverflowBlock policy is used.
+type Subscriber struct {
+	dropped int64 // atomic access
+	closed  int32 // atomic access
+
+	conn     *conn
+	overflow OverflowPolicy
+	ch       chan Message
+
+	mu    sync.Mutex
+	count int64 // number of channel and pattern subscriptions
+
+	done      chan struct{}
+	closeOnce sync.Once // close message channel
+}
+
+// DialSubscriber connects to the Redis server at address and returns a subscriber.
+func DialSubscriber(ctx context.Context, address string, dialer Dialer, opts SubscriberOptions) (*Subscriber, error) {
+	size := opts.Size
+	if size <= 0 {
+		size = DefaultSubscriberSize
+	}
+	s := &Subscriber{
+		overflow: opts.Overflow,
+		ch:       make(chan Message, size),
+		done:     make(chan struct{}),
+	}
+	dialer.subscriptionCallback = s.setCount
+	conn, err := dialer.dialContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	go s.watch()
+	return s, nil
+}
+
+// Messages returns the message channel. The channel is closed after the subscriber is closed
+// or the connection got lost (please see Dialer.Reconnect).
+func (s *Subscriber) Messages() <-chan Message { return s.ch }
+
+// Dropped returns the total number of messages dropped because of a full message channel.
+func (s *Subscriber) Dropped() int64 { return atomic.LoadInt64(&s.dropped) }
+
+// Count returns the number of channel and pattern subscriptions as reported by the last
+// subscribe or unsubscribe notification (including unsubscriptions by the server).
+func (s *Subscriber) Count() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// setCount is the subscription count callback function (connection handler).
+func (s *Subscriber) setCount(count int64) {
+	s.mu.Lock()
+	s.count = count
+	s.mu.Unlock()
+}
+
+// Subscribe subscribes to channels and returns the number of subscriptions.
+func (s *Subscriber) Subscribe(channels ...string) (int64, error) {
+	return s.exec(func() Result { return s.conn.Subscribe(channels, s.deliver) })
+}
+
+// Psubscribe subscribes to channel patterns and returns the number of subscriptions.
+func (s *Subscriber) Psubscribe(patterns ...string) (int64, error) {
+	return s.exec(func() Result { return s.conn.Psubscribe(patterns, s.deliver) })
+}
+
+// Unsubscribe unsubscribes from channels - from all channels if no channel is provided.
+// It returns the number of remaining subscriptions.
+func (s *Subscriber) Unsubscribe(channels ...string) (int64, error) {
+	return s.exec(func() Result { return s.conn.Unsubscribe(channels) })
+}
+
+// Punsubscribe unsubscribes from channel patterns - from all patterns if no pattern is provided.
+// It returns the number of remaining subscriptions.
+func (s *Subscriber) Punsubscribe(patterns ...string) (int64, error) {
+	return s.exec(func() Result { return s.conn.Punsubscribe(patterns) })
+}
+
+func (s *Subscriber) exec(cmd func() Result) (int64, error) {
+	if atomic.LoadInt32(&s.closed) != 0 {
+		return 0, ErrSubscriberClosed
+	}
+	return cmd().ToInt64() // count is set by the subscribe and unsubscribe notifications
+}
+
+// deliver is the message callback function (connection handler).
+func (s *Subscriber) deliver(pattern, channel, msg string) {
+	m := Message{Pattern: pattern, Channel: channel, Payload: msg}
+
+	switch s.overflow {
+	case OverflowDropNewest:
+		select {
+		case s.ch <- m:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.ch <- m:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+				atomic.AddInt64(&s.dropped, 1)
+			default: // message channel got read in the meanwhile
+			}
+		}
+	default:
+		select {
+		case s.ch <- m:
+		case <-s.done: // do not block closing the connection
+		}
+	}
+}
+
+// Close closes the subscriber connection and the message channel.
+// Messages not read before are still available in the message channel.
+func (s *Subscriber) Close() error {
+	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		return ErrSubscriberClosed
+	}
+	close(s.done)
+	err := s.conn.Close() // waits for the connection handler - no message is delivered afterwards
+	s.closeMessages()
+	return err
+}
+
+// watch closes the message channel after the connection got lost.
+func (s *Subscriber) watch() {
+	select {
+	case <-s.conn.shutdown: // connection handler stopped - no message is delivered afterwards
+		s.closeMessages()
+	case <-s.done:
+	}
+}
+
+func (s *Subscriber) closeMessages() { s.closeOnce.Do(func() { close(s.ch) }) }
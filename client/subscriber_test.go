@@ -0,0 +1,224 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func receiveMessage(t *testing.T, s *Subscriber) Message {
+	select {
+	case m := <-s.Messages():
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+	return Message{}
+}
+
+func TestSubscriber(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.ln.Close()
+
+	s, err := DialSubscriber(context.Background(), server.addr(), Dialer{}, SubscriberOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCount := func(count int64, err error, expected int64) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected || s.Count() != expected {
+			t.Fatalf("got: %d expected: %d subscriptions", count, expected)
+		}
+	}
+
+	count, err := s.Unsubscribe() // no subscription
+	testCount(count, err, 0)
+	count, err = s.Subscribe("ch1", "ch2")
+	testCount(count, err, 2)
+	count, err = s.Psubscribe("p*")
+	testCount(count, err, 3)
+
+	server.publish("ch1", "msg1")
+	if m := receiveMessage(t, s); m != (Message{Channel: "ch1", Payload: "msg1"}) {
+		t.Fatalf("unexpected message %v", m)
+	}
+	server.ppublish("p*", "pch", "msg2")
+	if m := receiveMessage(t, s); m != (Message{Pattern: "p*", Channel: "pch", Payload: "msg2"}) {
+		t.Fatalf("unexpected message %v", m)
+	}
+
+	count, err = s.Unsubscribe("ch1")
+	testCount(count, err, 2)
+	count, err = s.Punsubscribe()
+	testCount(count, err, 1)
+
+	server.publish("ch2", "msg3") // not read before close
+	deadline := time.Now().Add(time.Second)
+	for len(s.Messages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("message not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != ErrSubscriberClosed {
+		t.Fatalf("got: %v expected: %v", err, ErrSubscriberClosed)
+	}
+	if _, err := s.Subscribe("ch1"); err != ErrSubscriberClosed {
+		t.Fatalf("got: %v expected: %v", err, ErrSubscriberClosed)
+	}
+	if m := receiveMessage(t, s); m.Payload != "msg3" {
+		t.Fatalf("unexpected message %v", m)
+	}
+	if _, ok := <-s.Messages(); ok {
+		t.Fatal("message channel not closed")
+	}
+}
+
+func TestSubscriberOverflow(t *testing.T) {
+	for _, test := range []struct {
+		overflow OverflowPolicy
+		payloads []string
+	}{
+		{OverflowDropNewest, []string{"0", "1"}},
+		{OverflowDropOldest, []string{"3", "4"}},
+	} {
+		server := newFakeServer(t)
+		s, err := DialSubscriber(context.Background(), server.addr(), Dialer{}, SubscriberOptions{Size: 2, Overflow: test.overflow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Subscribe("ch"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			server.publish("ch", strconv.Itoa(i))
+		}
+		deadline := time.Now().Add(time.Second)
+		for s.Dropped() != 3 {
+			if time.Now().After(deadline) {
+				t.Fatalf("got: %d expected: %d dropped messages", s.Dropped(), 3)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		for _, payload := range test.payloads {
+			if m := receiveMessage(t, s); m.Payload != payload {
+				t.Fatalf("got: %s expected: %s", m.Payload, payload)
+			}
+		}
+		s.Close()
+		server.ln.Close()
+	}
+}
+
+func TestSubscriberCloseBlocked(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.ln.Close()
+
+	s, err := DialSubscriber(context.Background(), server.addr(), Dialer{}, SubscriberOptions{Size: 1, Overflow: OverflowBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Subscribe("ch"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ { // block connection handler
+		server.publish("ch", strconv.Itoa(i))
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error)
+	go func() { done <- s.Close() }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("close blocked by message delivery")
+	}
+}
+
+func TestSubscriberServerUnsubscribe(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.ln.Close()
+
+	s, err := DialSubscriber(context.Background(), server.addr(), Dialer{}, SubscriberOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Subscribe("ch1", "ch2"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.push(">3\r\n$11\r\nunsubscribe\r\n$3\r\nch1\r\n:1\r\n") // unsubscribed by server
+	deadline := time.Now().Add(time.Second)
+	for s.Count() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got: %d expected: %d subscriptions", s.Count(), 1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// connection still in sync
+	if count, err := s.Unsubscribe("ch2"); err != nil || count != 1 { // server keeps ch1 subscribed
+		t.Fatalf("got: %d %v expected: %d subscriptions", count, err, 1)
+	}
+}
+
+func TestSubscriberConnectionLost(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.ln.Close()
+
+	s, err := DialSubscriber(context.Background(), server.addr(), Dialer{}, SubscriberOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Subscribe("ch"); err != nil {
+		t.Fatal(err)
+	}
+	server.publish("ch", "msg")
+	server.dropAll()
+
+	done := make(chan []Message)
+	go func() {
+		var msgs []Message
+		for m := range s.Messages() {
+			msgs = append(msgs, m)
+		}
+		done <- msgs
+	}()
+	select {
+	case msgs := <-done:
+		if len(msgs) != 1 || msgs[0].Payload != "msg" {
+			t.Fatalf("unexpected messages %v", msgs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message channel not closed after connection loss")
+	}
+}
@@ -194,6 +194,7 @@ var fcts = []fct{
 	{client.CmdHscan, testHscan, true},
 	// pubsub
 	{"Pubsub", testPubsub, true},
+	{"ShardedPubsub", testShardedPubsub, true},
 	// Sets
 	{client.CmdSadd, testSadd, true},
 	{client.CmdScard, testScard, true},
@@ -2345,6 +2346,34 @@ func testPubsub(conn client.Conn, ctx *testCTX, t *testing.T) {
 
 }
 
+func testShardedPubsub(conn client.Conn, ctx *testCTX, t *testing.T) {
+	version := conn.ConnInfo().RedisVersion
+	if version.Compare(client.ParseVersion(client.CmdSsubscribeVersion)) == -1 {
+		t.Logf("sharded pubsub not available in redis version %s - expected %s", version, client.CmdSsubscribeVersion)
+		return
+	}
+
+	channel := client.RandomKey("")
+	ch := make(chan string, 1)
+
+	assertNil(t, conn.Ssubscribe([]string{channel}, msgCallback(ch)).Err())
+	noOfClients, err := conn.Spublish(channel, "mymessage").ToInt64()
+	assertNil(t, err)
+	assertEqual(t, noOfClients, 1)
+	r := <-ch
+	assertEqual(t, r, "mymessage")
+
+	channels, err := conn.PubsubShardchannels(nil).ToStringSlice()
+	assertNil(t, err)
+	t.Logf("shard channels: %v", channels)
+
+	slice, err := conn.PubsubShardnumsub([]string{channel}).ToStringSlice()
+	assertNil(t, err)
+	t.Logf("number of shard subscribers: %v", slice)
+
+	assertNil(t, conn.Sunsubscribe(nil).Err())
+}
+
 // Sets
 func testSadd(conn client.Conn, ctx *testCTX, t *testing.T) {
 	key := ctx.newKey("mySet")
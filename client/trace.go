@@ -29,13 +29,13 @@ type trace struct {
 	mu  sync.Mutex
 }
 
-func tracer(cb TraceCallback, rw io.ReadWriter) (Encoder, Decoder) {
+func tracer(cb TraceCallback, rw io.ReadWriter) (*encode, Decoder) {
 	t := &trace{cb: cb, b: make([]byte, 0, 64)}
 
 	encWriter := newTraceWriter(t.writeEnc)
 	decWriter := newTraceWriter(t.writeDec)
 
-	enc := NewEncoder(io.MultiWriter(rw, encWriter))
+	enc := newEncode(io.MultiWriter(rw, encWriter))
 
 	// !Caution: use 'own' bufio.Writer (even Decoder would create its own).
 	// We need to be sure, that the TeeReader is based on bufio.Reader and NOT based on
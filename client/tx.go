@@ -0,0 +1,258 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTxConflict is returned by an optimistic transaction in case a watched key was modified
+// by another client in each of the TxMaxAttempts transaction attempts.
+var ErrTxConflict = errors.New(ClientName + ": transaction conflict")
+
+// Optimistic transaction retry parameters.
+const (
+	TxMaxAttempts = 10                    // Maximum number of transaction attempts.
+	TxBackoffMin  = 10 * time.Millisecond // Minimal duration to wait before the next transaction attempt.
+	TxBackoffMax  = time.Second           // Maximal duration to wait before the next transaction attempt.
+)
+
+var txBackoff = ExponentialBackoff(TxBackoffMin, TxBackoffMax)
+
+// TxFunc is the function type of an optimistic transaction (please see Conn.Tx).
+type TxFunc func(tx Tx) error
+
+// Tx is an optimistic transaction.
+type Tx interface {
+	// Commands are executed immediately on the transaction connection (e.g. reading the watched keys).
+	Commands
+	// Queue returns the commands executed by the transaction (MULTI / EXEC) after the transaction
+	// function returned (please see TxPipeline for the results of the queued commands).
+	// The results of the queued commands are not available within the transaction function.
+	// In case the transaction function fails, the results of the queued commands get the function error set.
+	Queue() Commands
+}
+
+// Tx executes the optimistic transaction fn watching keys (WATCH / MULTI / EXEC).
+// In case a watched key was modified before the transaction was executed, the queued commands
+// are discarded and fn is called again after a backoff up to TxMaxAttempts times.
+// In case fn fails, the keys are unwatched and the function error is returned (wrapping the UNWATCH error if any).
+// The connection must not be used concurrently during the transaction.
+func (c *conn) Tx(ctx context.Context, keys []interface{}, fn TxFunc) error {
+	for attempt := 1; ; attempt++ {
+		err := c.tx(ctx, keys, fn)
+		if err != ErrTxConflict || attempt >= TxMaxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(txBackoff(attempt)):
+		}
+	}
+}
+
+// tx executes a single transaction attempt.
+func (c *conn) tx(ctx context.Context, keys []interface{}, fn TxFunc) error {
+	cmds := c.WithContext(ctx)
+	if len(keys) > 0 {
+		if err := cmds.Watch(keys).Err(); err != nil {
+			return err
+		}
+	}
+	t := newTx(ctx, c)
+	if err := fn(t); err != nil {
+		t.queue.fail(err)
+		if len(keys) > 0 {
+			if uerr := cmds.Unwatch().Err(); uerr != nil { // the transaction function error takes precedence
+				return fmt.Errorf("%w (unwatch: %s)", err, uerr)
+			}
+		}
+		return err
+	}
+	if len(t.queue.results) == 0 {
+		if len(keys) == 0 {
+			return nil
+		}
+		return cmds.Unwatch().Err()
+	}
+	return t.queue.Flush()
+}
+
+type tx struct {
+	queue     *txPipeline
+	queueCmds Commands
+	*command
+}
+
+func newTx(ctx context.Context, c *conn) *tx {
+	queue := newTxPipeline(c)
+	queue.ctx = ctx
+	return &tx{
+		queue:     queue,
+		queueCmds: queue.WithContext(ctx),
+		command:   newCommand(contextSend(ctx, c.send), c.sendInterceptor),
+	}
+}
+
+func (t *tx) Queue() Commands { return t.queueCmds }
+
+// TxPipeline is a pipeline executing the queued commands as transaction (MULTI / EXEC).
+// In contrast to a pipeline including MULTI and EXEC commands, the result of a queued command is
+// its reply within the EXEC reply instead of QUEUED (please see ReplyQueued):
+//   - a command failing within the transaction gets the command error set,
+//   - in case the transaction got aborted because a command could not be queued, all results get the EXECABORT error set,
+//   - in case the transaction was not executed because a watched key was modified, all results get ErrTxConflict set.
+//
+// Multiple goroutines must not invoke methods on a TxPipeline simultaneously.
+type TxPipeline interface {
+	Commands
+	// WithContext returns the transaction pipeline commands bound to ctx.
+	// Waiting for a command result is stopped when ctx is done.
+	WithContext(ctx context.Context) Commands
+	Reset()
+	// Flush executes the queued commands as transaction returning the transaction error
+	// (e.g. EXECABORT or ErrTxConflict).
+	Flush() error
+}
+
+var _ TxPipeline = (*txPipeline)(nil)
+
+type txPipeline struct {
+	ctx     context.Context // bound context of MULTI and EXEC - nil otherwise
+	c       *conn
+	results []*result
+	*command
+}
+
+func newTxPipeline(c *conn) *txPipeline {
+	p := &txPipeline{c: c}
+	p.command = newCommand(p.send, c.sendInterceptor)
+	return p
+}
+
+func (p *txPipeline) send(name string, r *result) {
+	if p.c.isShutdown() {
+		r.setErr(ErrInShutdown)
+		return
+	}
+	p.results = append(p.results, r)
+}
+
+func (p *txPipeline) WithContext(ctx context.Context) Commands {
+	return newCommand(contextSend(ctx, p.send), p.c.sendInterceptor)
+}
+
+func (p *txPipeline) Reset() {
+	p.results = p.results[:0]
+}
+
+func (p *txPipeline) Flush() error {
+	if len(p.results) == 0 {
+		return nil
+	}
+	err := p.exec()
+	p.results = nil
+	return err
+}
+
+// fail acknowledges the queued results with err.
+func (p *txPipeline) fail(err error) {
+	for _, r := range p.results {
+		r.flush()
+		r.ack(nil, err)
+	}
+	p.results = nil
+}
+
+// exec sends the queued commands within MULTI / EXEC and acknowledges the queued results
+// with the corresponding EXEC reply values.
+func (p *txPipeline) exec() error {
+	abort := func(err error) error {
+		for _, r := range p.results {
+			r.ack(nil, err)
+		}
+		return err
+	}
+
+	for _, r := range p.results {
+		r.flush() // results are acknowledged by exec
+	}
+	// a command with invalid arguments would not be sent and the transaction executed without it
+	for _, r := range p.results {
+		if err := checkArgs(r.request.cmd); err != nil {
+			return abort(err)
+		}
+	}
+
+	results := freeResults.get()
+	results = append(results, p.newResult("MULTI"))
+	for _, r := range p.results {
+		results = append(results, p.newResult(r.request.cmd...))
+	}
+	exec := p.newResult("EXEC")
+	results = append(results, exec)
+
+	if err := p.c.flush(true, results); err != nil {
+		return abort(err)
+	}
+
+	value, err := exec.Value()
+	if err != nil { // EXECABORT, ...
+		return abort(err)
+	}
+	if a, ok := value.(attrRedisValue); ok {
+		value = a.RedisValue
+	}
+	values, ok := value.(_slice)
+	switch {
+	case value == _Null: // watched key modified
+		return abort(ErrTxConflict)
+	case !ok || len(values) != len(p.results):
+		return abort(newProtocolError("invalid EXEC reply %v", value))
+	}
+	for i, r := range p.results {
+		p.ack(r, values[i])
+	}
+	return nil
+}
+
+func (p *txPipeline) newResult(cmd ...interface{}) *result {
+	r := newResult()
+	r.ctx = p.ctx
+	r.request.cmd = append(r.request.cmd, cmd...)
+	return r
+}
+
+// ack acknowledges the queued result r with the EXEC reply value v of the command.
+func (p *txPipeline) ack(r *result, v RedisValue) {
+	if e, ok := v.(_error); ok {
+		r.ack(nil, e.err)
+		return
+	}
+	if p.c.isRESP2() {
+		v = resp2Value(r.request.cmd, v)
+	}
+	if r.request.w != nil {
+		r.ack(writeValue(r.request.w, v))
+		return
+	}
+	r.ack(v, nil)
+}
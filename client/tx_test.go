@@ -0,0 +1,269 @@
+/*
+Copyright 2020 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// txHandler implements WATCH / MULTI / EXEC for the fake server. The first conflicts
+// EXEC commands fail because of a modified watched key. UNKNOWN commands cannot be queued.
+type txHandler struct {
+	s         *fakeServer
+	conflicts int32
+
+	mu      sync.Mutex
+	queued  map[net.Conn][][]string
+	aborted map[net.Conn]bool
+}
+
+func newTxHandler(s *fakeServer, conflicts int32) *txHandler {
+	h := &txHandler{s: s, conflicts: conflicts, queued: make(map[net.Conn][][]string), aborted: make(map[net.Conn]bool)}
+	s.handle = h.handle
+	return h
+}
+
+func (h *txHandler) handle(c net.Conn, w *bufio.Writer, cmd []string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	queued, multi := h.queued[c]
+	switch name := strings.ToUpper(cmd[0]); {
+	case name == "MULTI":
+		h.queued[c] = [][]string{}
+		w.WriteString("+OK\r\n")
+	case name == "EXEC":
+		aborted := h.aborted[c]
+		delete(h.queued, c)
+		delete(h.aborted, c)
+		if aborted {
+			w.WriteString("-EXECABORT Transaction discarded because of previous errors.\r\n")
+			return true
+		}
+		if atomic.AddInt32(&h.conflicts, -1) >= 0 {
+			h.s.null(w)
+			return true
+		}
+		w.WriteString("*" + strconv.Itoa(len(queued)) + "\r\n")
+		for _, cmd := range queued {
+			h.exec(w, cmd)
+		}
+	case multi && name == "UNKNOWN":
+		h.aborted[c] = true
+		w.WriteString("-ERR unknown command `unknown`\r\n")
+	case multi:
+		h.queued[c] = append(queued, cmd)
+		w.WriteString("+QUEUED\r\n")
+	default:
+		return false
+	}
+	return true
+}
+
+func (h *txHandler) exec(w *bufio.Writer, cmd []string) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+
+	switch strings.ToUpper(cmd[0]) {
+	case "SET":
+		h.s.kv[cmd[1]] = cmd[2]
+		w.WriteString("+OK\r\n")
+	case "GET":
+		bulk(w, h.s.kv[cmd[1]])
+	default:
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	}
+}
+
+func TestTx(t *testing.T) {
+	for _, resp2 := range []bool{false, true} {
+		newServer := newFakeServer
+		if resp2 {
+			newServer = newRESP2FakeServer
+		}
+		s := newServer(t)
+		defer s.ln.Close()
+
+		newTxHandler(s, 1)
+
+		db := OpenDBWithOptions(s.addr(), Dialer{Protocol: ProtocolFallback}, DBOptions{MultiplexConns: 1})
+		defer db.Close()
+
+		if err := db.Set("counter", 1).Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		var attempts int
+		var results []Result
+		err := db.Tx(context.Background(), []interface{}{"counter"}, func(tx Tx) error {
+			attempts++
+			n, err := tx.Get("counter").ToInt64()
+			if err != nil {
+				return err
+			}
+			q := tx.Queue()
+			results = []Result{q.Set("counter", n+1), q.Get("counter"), q.Lpush("counter", []interface{}{"value"})}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 2 {
+			t.Fatalf("got: %d expected: %d attempts", attempts, 2)
+		}
+		if ok, err := results[0].ToBool(); err != nil || !ok {
+			t.Fatalf("unexpected result %v", err)
+		}
+		if v, err := results[1].ToString(); err != nil || v != "2" {
+			t.Fatalf("got: %s expected: %s", v, "2")
+		}
+		if err, ok := results[2].Err().(*RedisError); !ok || err.Code != "WRONGTYPE" {
+			t.Fatalf("got: %v expected: WRONGTYPE error", results[2].Err())
+		}
+		if n := s.countCmds("WATCH COUNTER"); n != 2 {
+			t.Fatalf("got: %d expected: %d WATCH commands", n, 2)
+		}
+	}
+}
+
+func TestTxPipeline(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	newTxHandler(s, 0)
+
+	conn, err := Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	p := conn.TxPipeline()
+	r1 := p.Set("key", "value")
+	r2 := p.Get("key")
+	r3 := p.Lpush("key", []interface{}{"value"})
+	if err := r1.Err(); err != ErrNotFlushed {
+		t.Fatalf("got: %v expected: %v", err, ErrNotFlushed)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := r1.ToBool(); err != nil || !ok {
+		t.Fatalf("unexpected result %v", err)
+	}
+	if v, err := r2.ToString(); err != nil || v != "value" {
+		t.Fatalf("got: %s expected: %s", v, "value")
+	}
+	if err, ok := r3.Err().(*RedisError); !ok || err.Code != "WRONGTYPE" {
+		t.Fatalf("got: %v expected: WRONGTYPE error", r3.Err())
+	}
+
+	// transaction aborted because a command could not be queued
+	r1 = p.Set("key", "value")
+	r2 = p.Do("unknown")
+	err = p.Flush()
+	if err, ok := err.(*RedisError); !ok || err.Code != "EXECABORT" {
+		t.Fatalf("got: %v expected: EXECABORT error", err)
+	}
+	for _, r := range []Result{r1, r2} {
+		if r.Err() != err {
+			t.Fatalf("got: %v expected: %v", r.Err(), err)
+		}
+	}
+
+	// transaction not executed because of an invalid argument
+	r1 = p.Set("key", "other")
+	r2 = p.Set("key", struct{ A int }{1})
+	var typeErr *InvalidTypeError
+	if err := p.Flush(); !errors.As(err, &typeErr) {
+		t.Fatalf("got: %v expected: %T", err, typeErr)
+	}
+	for _, r := range []Result{r1, r2} {
+		if err := r.Err(); !errors.As(err, &typeErr) {
+			t.Fatalf("got: %v expected: %T", err, typeErr)
+		}
+	}
+
+	// connection is still in sync
+	if v, err := conn.Get("key").ToString(); err != nil || v != "value" {
+		t.Fatalf("got: %s expected: %s", v, "value")
+	}
+}
+
+func TestTxFail(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.ln.Close()
+
+	newTxHandler(s, 1<<30)
+
+	conn, err := Dial(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// conflicts until context is done
+	var r Result
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = conn.Tx(ctx, []interface{}{"key"}, func(tx Tx) error {
+		r = tx.Queue().Set("key", "value")
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got: %v expected: %v", err, context.DeadlineExceeded)
+	}
+	if err := r.Err(); err != ErrTxConflict {
+		t.Fatalf("got: %v expected: %v", err, ErrTxConflict)
+	}
+
+	// transaction function error
+	errAbort := errors.New("abort")
+	err = conn.Tx(context.Background(), []interface{}{"key"}, func(tx Tx) error {
+		r = tx.Queue().Set("key", "value")
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("got: %v expected: %v", err, errAbort)
+	}
+	if err := r.Err(); err != errAbort {
+		t.Fatalf("got: %v expected: %v", err, errAbort)
+	}
+	if n := s.countCmds("UNWATCH"); n != 1 {
+		t.Fatalf("got: %d expected: %d UNWATCH commands", n, 1)
+	}
+
+	// no UNWATCH without watched keys
+	if err := conn.Tx(context.Background(), nil, func(tx Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Tx(context.Background(), nil, func(tx Tx) error { return errAbort }); err != errAbort {
+		t.Fatalf("got: %v expected: %v", err, errAbort)
+	}
+	if n := s.countCmds("UNWATCH"); n != 1 {
+		t.Fatalf("got: %d expected: %d UNWATCH commands", n, 1)
+	}
+}
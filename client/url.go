@@ -0,0 +1,398 @@
+/*
+Copyright 2019 Stefan Miller
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Address URL schemes.
+const (
+	schemeRedis  = "redis"
+	schemeRediss = "rediss" // TLS
+	schemeUnix   = "unix"
+)
+
+// Address URL query options.
+const (
+	optDB              = "db"
+	optClientName      = "client_name"
+	optSkipVerify      = "skip_verify"
+	optServerName      = "server_name"
+	optDialTimeout     = "dial_timeout"
+	optAsyncTimeout    = "async_timeout"
+	optChannelSize     = "channel_size"
+	optProtocol        = "protocol"
+	optMaxOpenConns    = "max_open_conns"
+	optMaxIdleConns    = "max_idle_conns"
+	optConnMaxLifetime = "conn_max_lifetime"
+	optConnMaxIdleTime = "conn_max_idle_time"
+)
+
+// protocolNames are the protocol option values.
+var protocolNames = map[string]ProtocolMode{
+	"resp3":    ProtocolRESP3,
+	"fallback": ProtocolFallback,
+	"resp2":    ProtocolRESP2,
+}
+
+const redacted = "xxxxx"
+
+// poolLimits are the connection pool limits of a database - nil values are not set.
+type poolLimits struct {
+	maxOpen, maxIdle         *int
+	maxLifetime, maxIdleTime *time.Duration
+}
+
+// apply sets the limits of db.
+func (l *poolLimits) apply(db DB) {
+	if l.maxOpen != nil {
+		db.SetMaxOpenConns(*l.maxOpen)
+	}
+	if l.maxIdle != nil {
+		db.SetMaxIdleConns(*l.maxIdle)
+	}
+	if l.maxLifetime != nil {
+		db.SetConnMaxLifetime(*l.maxLifetime)
+	}
+	if l.maxIdleTime != nil {
+		db.SetConnMaxIdleTime(*l.maxIdleTime)
+	}
+}
+
+// An addressURL is a parsed server address.
+type addressURL struct {
+	network, address   string
+	url                bool // address is an URL
+	auth               bool // user info provided
+	username, password string
+	db                 int
+	clientName         string
+	tls                bool
+	host               string // TLS server name default
+	skipVerify         bool
+	serverName         string
+	dialTimeout        time.Duration
+	asyncTimeout       time.Duration
+	channelSize        int
+	protocol           *ProtocolMode
+	pool               *poolLimits
+}
+
+// ParseURL parses a Redis URL and returns a Dialer with the options of the URL and the server address
+// to be used with Dialer.Dial or OpenDB. The URL format is
+//
+//	redis://[[username]:password@]host[:port][/db][?options]
+//	rediss://[[username]:password@]host[:port][/db][?options] (TLS)
+//	unix://[[username]:password@]/path[?options] (unix domain socket)
+//
+// Options are
+//   - db: database selected after connecting (alternative to the URL path),
+//   - client_name: client name,
+//   - skip_verify and server_name: TLS verification (rediss only),
+//   - dial_timeout and async_timeout: timeouts (e.g. 5s),
+//   - channel_size: size of the connection channels,
+//   - protocol: protocol mode (resp3, fallback or resp2) and
+//   - max_open_conns, max_idle_conns, conn_max_lifetime and conn_max_idle_time: connection pool limits
+//     applied by OpenDB.
+func ParseURL(rawurl string) (*Dialer, string, error) {
+	if !isURL(rawurl) {
+		return nil, "", errors.New("invalid URL: missing scheme")
+	}
+	a, err := parseAddress(rawurl)
+	if err != nil {
+		return nil, "", err
+	}
+	return a.dialer(&Dialer{}), a.dialAddress(), nil
+}
+
+// RedactedURL returns the URL of the dialer options and address with the password replaced
+// (e.g. for logging). Parsing the URL by ParseURL results in the same options apart from the password,
+// the TLS configuration besides server name and verification and options not available as URL options.
+// In case the address cannot be parsed an error is returned.
+func (d *Dialer) RedactedURL(address string) (string, error) {
+	u, err := d.url(address)
+	if err != nil {
+		return "", err
+	}
+	return redactURL(u), nil
+}
+
+// url returns the URL of the dialer options and address.
+func (d *Dialer) url(address string) (*url.URL, error) {
+	a, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	d = a.dialer(d)
+
+	u := &url.URL{Scheme: schemeRedis, Host: a.address}
+	q := url.Values{}
+	switch {
+	case a.network == unixNetwork:
+		u.Scheme, u.Host, u.Path = schemeUnix, "", a.address
+		if d.DB != 0 {
+			q.Set(optDB, strconv.Itoa(d.DB))
+		}
+	case d.DB != 0:
+		u.Path = "/" + strconv.Itoa(d.DB)
+	}
+
+	switch {
+	case d.Password != "":
+		u.User = url.UserPassword(d.Username, d.Password)
+	case d.Username != "":
+		u.User = url.User(d.Username)
+	}
+
+	if d.TLSConfig != nil && a.network == tcpNetwork {
+		u.Scheme = schemeRediss
+		host, _, _ := net.SplitHostPort(a.address)
+		if d.TLSConfig.ServerName != "" && d.TLSConfig.ServerName != host {
+			q.Set(optServerName, d.TLSConfig.ServerName)
+		}
+		if d.TLSConfig.InsecureSkipVerify {
+			q.Set(optSkipVerify, strconv.FormatBool(true))
+		}
+	}
+	if d.ClientName != "" {
+		q.Set(optClientName, d.ClientName)
+	}
+	if d.Timeout != 0 {
+		q.Set(optDialTimeout, d.Timeout.String())
+	}
+	if d.AsyncTimeout != 0 {
+		q.Set(optAsyncTimeout, d.AsyncTimeout.String())
+	}
+	if d.ChannelSize != 0 {
+		q.Set(optChannelSize, strconv.Itoa(d.ChannelSize))
+	}
+	if d.Protocol != ProtocolRESP3 {
+		for name, protocol := range protocolNames {
+			if protocol == d.Protocol {
+				q.Set(optProtocol, name)
+			}
+		}
+	}
+	if l := d.pool; l != nil {
+		if l.maxOpen != nil {
+			q.Set(optMaxOpenConns, strconv.Itoa(*l.maxOpen))
+		}
+		if l.maxIdle != nil {
+			q.Set(optMaxIdleConns, strconv.Itoa(*l.maxIdle))
+		}
+		if l.maxLifetime != nil {
+			q.Set(optConnMaxLifetime, l.maxLifetime.String())
+		}
+		if l.maxIdleTime != nil {
+			q.Set(optConnMaxIdleTime, l.maxIdleTime.String())
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// isURL returns true if address is an URL - false for host:port addresses.
+func isURL(address string) bool { return strings.Contains(address, "://") }
+
+// parseAddress parses a server address, which is a host:port address or an URL (please see ParseURL).
+func parseAddress(address string) (*addressURL, error) {
+	if !isURL(address) {
+		return &addressURL{network: tcpNetwork, address: hostPort(address)}, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &addressURL{url: true}
+	switch u.Scheme {
+	case schemeRedis, schemeRediss:
+		host, port := u.Hostname(), u.Port()
+		if host == "" {
+			host = LocalHost
+		}
+		if port == "" {
+			port = DefaultRedisPort
+		}
+		a.network, a.address = tcpNetwork, net.JoinHostPort(host, port)
+		a.tls, a.host = u.Scheme == schemeRediss, u.Hostname()
+		if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+			if a.db, err = strconv.Atoi(db); err != nil || a.db < 0 {
+				return nil, fmt.Errorf("invalid database %s in address %s", db, redactURL(u))
+			}
+		}
+	case schemeUnix:
+		if u.Path == "" {
+			return nil, fmt.Errorf("missing socket path in address %s", redactURL(u))
+		}
+		a.network, a.address = unixNetwork, u.Path
+	default:
+		return nil, fmt.Errorf("invalid scheme %s in address %s", u.Scheme, redactURL(u))
+	}
+
+	if u.User != nil {
+		a.auth = true
+		a.username = u.User.Username()
+		a.password, _ = u.User.Password()
+	}
+
+	for name, values := range u.Query() {
+		if err := a.setOption(name, values[len(values)-1]); err != nil {
+			return nil, fmt.Errorf("%s in address %s", err, redactURL(u))
+		}
+	}
+	return a, nil
+}
+
+func (a *addressURL) setOption(name, value string) error {
+	var err error
+	switch name {
+	case optDB:
+		if a.db, err = strconv.Atoi(value); err == nil && a.db < 0 {
+			err = errors.New("negative value")
+		}
+	case optClientName:
+		a.clientName = value
+	case optSkipVerify:
+		a.skipVerify, err = strconv.ParseBool(value)
+	case optServerName:
+		a.serverName = value
+	case optDialTimeout:
+		a.dialTimeout, err = time.ParseDuration(value)
+	case optAsyncTimeout:
+		a.asyncTimeout, err = time.ParseDuration(value)
+	case optChannelSize:
+		a.channelSize, err = strconv.Atoi(value)
+	case optProtocol:
+		protocol, ok := protocolNames[value]
+		if !ok {
+			err = errors.New("unknown protocol")
+		}
+		a.protocol = &protocol
+	case optMaxOpenConns, optMaxIdleConns:
+		var n int
+		if n, err = strconv.Atoi(value); err == nil {
+			if name == optMaxOpenConns {
+				a.poolLimits().maxOpen = &n
+			} else {
+				a.poolLimits().maxIdle = &n
+			}
+		}
+	case optConnMaxLifetime, optConnMaxIdleTime:
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil {
+			if name == optConnMaxLifetime {
+				a.poolLimits().maxLifetime = &d
+			} else {
+				a.poolLimits().maxIdleTime = &d
+			}
+		}
+	default:
+		return fmt.Errorf("unknown option %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid option %s=%s: %s", name, value, err)
+	}
+	if (name == optSkipVerify || name == optServerName) && !a.tls {
+		return fmt.Errorf("option %s requires scheme %s", name, schemeRediss)
+	}
+	return nil
+}
+
+func (a *addressURL) poolLimits() *poolLimits {
+	if a.pool == nil {
+		a.pool = &poolLimits{}
+	}
+	return a.pool
+}
+
+// dialAddress returns the address to be used with a Dialer having the URL options applied.
+func (a *addressURL) dialAddress() string {
+	if a.network == unixNetwork {
+		return schemeUnix + "://" + a.address
+	}
+	return a.address
+}
+
+// redactURL returns the URL string with the password replaced.
+func redactURL(u *url.URL) string {
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+	r := *u
+	r.User = url.UserPassword(u.User.Username(), redacted)
+	return r.String()
+}
+
+// dialer returns a copy of d with the options of the address applied.
+// In case the address is not an URL, d is returned.
+func (a *addressURL) dialer(d *Dialer) *Dialer {
+	if !a.url {
+		return d
+	}
+	c := *d
+	if a.auth {
+		c.Username, c.Password = a.username, a.password
+	}
+	if a.db != 0 {
+		c.DB = a.db
+	}
+	if a.clientName != "" {
+		c.ClientName = a.clientName
+	}
+	if a.tls {
+		if d.TLSConfig != nil {
+			c.TLSConfig = d.TLSConfig.Clone()
+		} else {
+			c.TLSConfig = &tls.Config{}
+		}
+		switch {
+		case a.serverName != "":
+			c.TLSConfig.ServerName = a.serverName
+		case c.TLSConfig.ServerName == "":
+			c.TLSConfig.ServerName = a.host
+		}
+		if a.skipVerify {
+			c.TLSConfig.InsecureSkipVerify = true
+		}
+	}
+	if a.dialTimeout != 0 {
+		c.Timeout = a.dialTimeout
+	}
+	if a.asyncTimeout != 0 {
+		c.AsyncTimeout = a.asyncTimeout
+	}
+	if a.channelSize != 0 {
+		c.ChannelSize = a.channelSize
+	}
+	if a.protocol != nil {
+		c.Protocol = *a.protocol
+	}
+	if a.pool != nil {
+		c.pool = a.pool
+	}
+	return &c
+}
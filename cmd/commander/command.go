@@ -28,6 +28,16 @@ type command struct {
 	Arguments  []*argument `json:"arguments"`
 	Since      string      `json:"since"`
 	Group      string      `json:"group"`
+	Flags      []string    `json:"command_flags"`
+}
+
+func (c *command) hasFlag(flag string) bool {
+	for _, f := range c.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
 }
 
 type vName struct {
@@ -106,7 +106,7 @@ func (c *converter) adapt(cmd string, command *command) {
 func (c *converter) convertCommand(cmdKey string, cmd *command) {
 	name := cmdName(cmdKey)
 	funcDecl := ast.NewFuncDecl(name, name, strings.Split(cmdKey, " "))
-	funcAttr := ast.NewFuncAttr(name, cmd.Summary, cmd.Complexity, cmd.Since, cmd.Group)
+	funcAttr := ast.NewFuncAttr(name, cmd.Summary, cmd.Complexity, cmd.Since, cmd.Group, cmd.hasFlag("readonly"))
 
 	c.s.InsertDecl(funcAttr)
 	if !c.s.InsertDecl(funcDecl) {
@@ -34,6 +34,9 @@ const (
 	callSetErr = "setErr"
 )
 
+// extIntfNames are the names of the hand-written command interfaces embedded in the Commands interface.
+var extIntfNames = []string{"HashStruct", "Bulk"}
+
 type sorter struct {
 	key   string
 	value string
@@ -193,6 +196,9 @@ func (g *generator) generateInterfaces(groupIdx []groupIdx) {
 	for _, e := range groupIdx {
 		g.b.writeln(e.key, intfName)
 	}
+	for _, name := range extIntfNames {
+		g.b.writeln(name, intfName)
+	}
 	g.b.endBlock()
 
 	for _, e := range groupIdx {
@@ -444,6 +450,18 @@ func (g *generator) generateMethodConsts() {
 		g.b.writeln("Cmd", decl.Name, ",")
 	})
 	g.b.endInit()
+
+	g.b.startInit("var ReadonlyCommands = map[string]bool")
+	g.s.LoopFunc(func(decl *ast.FuncDecl) {
+		attr := g.s.LookupFuncAttr(decl.Attr)
+		if attr == nil {
+			panic("function attributes (group) not found: " + decl.Attr) // should never happen
+		}
+		if attr.Readonly {
+			g.b.writeln("Cmd", decl.Name, ": true,")
+		}
+	})
+	g.b.endInit()
 }
 
 type groupIdx struct {
@@ -172,16 +172,18 @@ type FuncAttr struct {
 	Complexity string `json:"complexity"`
 	Since      string `json:"since"`
 	Group      string `json:"group"`
+	Readonly   bool   `json:"readonly,omitempty"`
 }
 
 // NewFuncAttr is the FuncAttr constructor.
-func NewFuncAttr(name, summary, complexity, since, group string) *FuncAttr {
+func NewFuncAttr(name, summary, complexity, since, group string, readonly bool) *FuncAttr {
 	return &FuncAttr{
 		Name:       name,
 		Summary:    summary,
 		Complexity: complexity,
 		Since:      since,
 		Group:      group,
+		Readonly:   readonly,
 	}
 }
 
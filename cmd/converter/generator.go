@@ -122,6 +122,31 @@ const resultTemplate = `func (r *result) %[1]s() (%[2]s) {
 }
 `
 
+// releaseResultTemplate is used for conversions not returning Redis values,
+// so the reply arena of the result can be released after the conversion.
+const releaseResultTemplate = `func (r *result) %[1]s() (%[2]s) {
+	if err := r.wait(); err != nil {
+		return %[3]s, err
+	}
+	defer r.release()
+	return r.value.%[1]s()
+}
+`
+
+// redisValueFcts are the conversions returning Redis values (directly or nested).
+var redisValueFcts = map[string]bool{
+	"ToIntfSlice":      true,
+	"ToIntfSlice2":     true,
+	"ToIntfSlice3":     true,
+	"ToMap":            true,
+	"ToSet":            true,
+	"ToSlice":          true,
+	"ToStringMap":      true,
+	"ToStringMapSlice": true,
+	"ToStringValueMap": true,
+	"ToTree":           true,
+}
+
 func (g *generator) generateResultFcts(a *analyzer, pkg string) []byte {
 	g.b.b.Reset()
 	g.writeHeader(pkg)
@@ -131,7 +156,11 @@ func (g *generator) generateResultFcts(a *analyzer, pkg string) []byte {
 		fctName := field.Names[0].Name
 
 		types := g.types(field.Type.(*ast.FuncType).Results)
-		g.b.writeln(fmt.Sprintf(resultTemplate, fctName, strings.Join(types, ", "), typeInitialValue(types[0])))
+		template := releaseResultTemplate
+		if redisValueFcts[fctName] {
+			template = resultTemplate
+		}
+		g.b.writeln(fmt.Sprintf(template, fctName, strings.Join(types, ", "), typeInitialValue(types[0])))
 	}
 	return g.b.format()
 }
@@ -139,7 +168,7 @@ func (g *generator) generateResultFcts(a *analyzer, pkg string) []byte {
 const attrTemplate = `func (%[1]s %[2]s) Attr() *Map { return nil }`
 const convertTemplate = `func (%[1]s %[2]s) %[3]s() (%[4]s) {return %[5]s, newConversionError("%[3]s", %[1]s)}`
 
-var objNames = []string{"_null", "_string", "_number", "_double", "_bignumber", "_boolean", "_verbatimString", "_slice", "_map", "_set"}
+var objNames = []string{"_null", "_string", "_number", "_double", "_bignumber", "_boolean", "_verbatimString", "_slice", "_map", "_set", "_error"}
 
 func (g *generator) objVarname(objName string, objs map[string]map[string]*ast.FuncDecl) string {
 	if mths, ok := objs[objName]; ok {